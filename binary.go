@@ -0,0 +1,305 @@
+package trie
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+/*
+The binary format written by WriteTo encodes the Branches themselves, so
+reading it back is a linear decode without re-adding any entries:
+
+	magic     4 bytes  "TRIE"
+	version   1 byte
+	root      Branch
+	checksum  4 bytes  CRC-32 (IEEE, big endian) of the encoded root
+
+Every Branch is encoded as
+
+	leaf length      uvarint
+	leaf             bytes
+	flags            1 byte (bit 0: End)
+	count            uvarint - only if End is set
+	branch count     uvarint
+	branches         for each branch in ascending order: index byte, Branch
+
+Payloads are not written.
+*/
+const (
+	binaryMagic   = "TRIE"
+	binaryVersion = 1
+
+	binaryFlagEnd = 1 << 0
+)
+
+var (
+	ErrBadMagic           = errors.New("Not a binary Trie dump")
+	ErrUnsupportedVersion = errors.New("Unsupported binary Trie dump version")
+	ErrChecksum           = errors.New("Binary Trie dump checksum mismatch")
+)
+
+/*
+WriteTo writes the Trie in the binary format to `w`. It returns the number of
+bytes written. WriteTo implements io.WriterTo.
+*/
+func (t *Trie) WriteTo(w io.Writer) (n int64, err error) {
+	t.Root.RLock()
+	defer t.Root.RUnlock()
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	if _, err = bw.WriteString(binaryMagic); err != nil {
+		return cw.n, err
+	}
+	if err = bw.WriteByte(binaryVersion); err != nil {
+		return cw.n, err
+	}
+
+	crc := crc32.NewIEEE()
+	enc := &binaryEncoder{w: io.MultiWriter(bw, crc)}
+	enc.branch(t.Root)
+	if enc.err != nil {
+		return cw.n, enc.err
+	}
+
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc.Sum32())
+	if _, err = bw.Write(sum[:]); err != nil {
+		return cw.n, err
+	}
+	err = bw.Flush()
+	return cw.n, err
+}
+
+/*
+ReadFrom replaces the content of the Trie with a binary dump read from `r`.
+It returns the number of bytes read. The Trie is left unchanged if the dump
+can not be read. ReadFrom implements io.ReaderFrom.
+
+ReadFrom never reads past the end of the dump, so whatever follows it can be
+read from `r` afterwards. If `r` does not implement io.ByteReader it is read
+one byte at a time - wrap it in a bufio.Reader to read a dump from a file.
+*/
+func (t *Trie) ReadFrom(r io.Reader) (n int64, err error) {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		br = &byteReader{r: r}
+	}
+	dec := &binaryDecoder{r: br}
+	defer func() {
+		n = dec.n
+	}()
+
+	header := dec.read(len(binaryMagic) + 1)
+	if dec.err != nil {
+		err = errors.New(fmt.Sprintf("Could not read binary Trie header: %v", dec.err))
+		return
+	}
+	if string(header[:len(binaryMagic)]) != binaryMagic {
+		return 0, ErrBadMagic
+	}
+	if header[len(binaryMagic)] != binaryVersion {
+		return 0, ErrUnsupportedVersion
+	}
+
+	crc := crc32.NewIEEE()
+	dec.crc = crc
+	root := dec.branch()
+	if dec.err != nil {
+		err = errors.New(fmt.Sprintf("Could not decode binary Trie: %v", dec.err))
+		return
+	}
+
+	dec.crc = nil
+	sum := dec.read(4)
+	if dec.err != nil {
+		err = errors.New(fmt.Sprintf("Could not read binary Trie checksum: %v", dec.err))
+		return
+	}
+	if binary.BigEndian.Uint32(sum) != crc.Sum32() {
+		return 0, ErrChecksum
+	}
+
+	t.Root.Lock()
+	t.Root.Branches = root.Branches
+	t.Root.LeafValue = root.LeafValue
+	t.Root.End = root.End
+	t.Root.Count = root.Count
+	t.Root.MaxCount = root.MaxCount
+	t.Root.digest = root.digest
+	t.Root.Payload = nil
+	t.logOp(walDeletePrefix, "", 0)
+	if t.wal != nil {
+		for _, mi := range t.Root.members([]byte{}, false) {
+			t.logOp(walAdd, mi.Value, mi.Count)
+		}
+	}
+	t.Root.Unlock()
+	return
+}
+
+/*
+binaryEncoder writes Branches in the binary format. The first error stops all
+further writes.
+*/
+type binaryEncoder struct {
+	w   io.Writer
+	buf [binary.MaxVarintLen64]byte
+	err error
+}
+
+func (enc *binaryEncoder) write(p []byte) {
+	if enc.err == nil {
+		_, enc.err = enc.w.Write(p)
+	}
+}
+
+func (enc *binaryEncoder) uvarint(x uint64) {
+	enc.write(enc.buf[:binary.PutUvarint(enc.buf[:], x)])
+}
+
+func (enc *binaryEncoder) branch(b *Branch) {
+	enc.uvarint(uint64(len(b.LeafValue)))
+	enc.write(b.LeafValue)
+	if b.End {
+		enc.write([]byte{binaryFlagEnd})
+		enc.uvarint(uint64(b.Count))
+	} else {
+		enc.write([]byte{0})
+	}
+	enc.uvarint(uint64(len(b.Branches)))
+	for _, idx := range b.sortedIdxs(false) {
+		enc.write([]byte{idx})
+		enc.branch(b.Branches[idx])
+	}
+}
+
+/*
+binaryDecoder reads Branches in the binary format. It counts the bytes it reads
+and feeds them into the checksum if there is one. The first error stops the
+decoding.
+*/
+type binaryDecoder struct {
+	r   io.ByteReader
+	crc hash.Hash32
+	n   int64
+	err error
+}
+
+func (dec *binaryDecoder) readByte() byte {
+	if dec.err != nil {
+		return 0
+	}
+	c, err := dec.r.ReadByte()
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		dec.err = err
+		return 0
+	}
+	dec.n++
+	if dec.crc != nil {
+		dec.crc.Write([]byte{c})
+	}
+	return c
+}
+
+func (dec *binaryDecoder) read(size int) []byte {
+	p := make([]byte, 0, size)
+	for i := 0; i < size && dec.err == nil; i++ {
+		p = append(p, dec.readByte())
+	}
+	return p
+}
+
+func (dec *binaryDecoder) uvarint() uint64 {
+	var x uint64
+	for shift := uint(0); shift < 64; shift += 7 {
+		c := dec.readByte()
+		if dec.err != nil {
+			return 0
+		}
+		x |= uint64(c&0x7f) << shift
+		if c < 0x80 {
+			return x
+		}
+	}
+	dec.err = errors.New("uvarint overflows 64 bits")
+	return 0
+}
+
+func (dec *binaryDecoder) branch() *Branch {
+	b := &Branch{
+		Branches: make(map[byte]*Branch),
+	}
+
+	leafLen := dec.uvarint()
+	if dec.err != nil {
+		return nil
+	}
+	if leafLen > 0 {
+		b.LeafValue = make([]byte, 0, minInt(int(leafLen), 4096))
+		for i := uint64(0); i < leafLen && dec.err == nil; i++ {
+			b.LeafValue = append(b.LeafValue, dec.readByte())
+		}
+	}
+
+	flags := dec.readByte()
+	if flags&binaryFlagEnd != 0 {
+		b.End = true
+		b.Count = int64(dec.uvarint())
+	}
+
+	numBranches := dec.uvarint()
+	if numBranches > 256 {
+		dec.err = errors.New(fmt.Sprintf("invalid number of branches %v", numBranches))
+	}
+	lastIdx := -1
+	for i := uint64(0); i < numBranches && dec.err == nil; i++ {
+		idx := dec.readByte()
+		if int(idx) <= lastIdx {
+			dec.err = errors.New(fmt.Sprintf("invalid branch index %v", idx))
+			break
+		}
+		lastIdx = int(idx)
+		if child := dec.branch(); child != nil {
+			b.Branches[idx] = child
+		}
+	}
+	if dec.err != nil {
+		return nil
+	}
+	b.updateMaxCount()
+	return b
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (n int, err error) {
+	n, err = cw.w.Write(p)
+	cw.n += int64(n)
+	return
+}
+
+/*
+byteReader reads from an io.Reader one byte at a time, so nothing is read past
+the bytes that were asked for.
+*/
+type byteReader struct {
+	r   io.Reader
+	buf [1]byte
+}
+
+func (br *byteReader) ReadByte() (byte, error) {
+	_, err := io.ReadFull(br.r, br.buf[:])
+	return br.buf[0], err
+}
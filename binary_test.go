@@ -0,0 +1,134 @@
+package trie
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func TestBinaryRoundTrip(t *testing.T) {
+	tr := NewTrie()
+	for _, w := range []string{"", "test", "test", "testing", "tea", "te", "foodchain", "日本", "日本語学校"} {
+		tr.Add(w)
+	}
+	for n := 0; n < 500; n++ {
+		str := []byte{}
+		for i := 0; i < 1+rand.Intn(8); i++ {
+			str = append(str, byte(rand.Intn(256)))
+		}
+		tr.AddWithCount(string(str), int64(1+rand.Intn(1000)))
+	}
+
+	var buf bytes.Buffer
+	n, err := tr.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("Expected WriteTo to succeed, got %v instead.", err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("Expected WriteTo to report %v bytes, got %v instead.", buf.Len(), n)
+	}
+	size := buf.Len()
+	// trailing data must not be consumed
+	buf.WriteString("rest")
+
+	tr2 := NewTrie()
+	tr2.Add("replaced")
+	n, err = tr2.ReadFrom(&buf)
+	if err != nil {
+		t.Fatalf("Expected ReadFrom to succeed, got %v instead.", err)
+	}
+	if n != int64(size) {
+		t.Errorf("Expected ReadFrom to report %v bytes, got %v instead.", size, n)
+	}
+	if tr2.Dump() != tr.Dump() {
+		t.Errorf("Expected the decoded Trie to equal the original, got\n%s\ninstead of\n%s", tr2.Dump(), tr.Dump())
+	}
+	if tr2.Root.MaxCount != tr.Root.MaxCount {
+		t.Errorf("Expected MaxCount %v, got %v instead.", tr.Root.MaxCount, tr2.Root.MaxCount)
+	}
+	if buf.String() != "rest" {
+		t.Errorf("Expected the trailing data to be left in the reader, got %q instead.", buf.String())
+	}
+	if tr2.Has("replaced") {
+		t.Error("Expected ReadFrom to replace the content of the Trie")
+	}
+	if _, c := tr2.HasCount("test"); c != 2 {
+		t.Errorf("Expected count for test to be 2. got %v instead.", c)
+	}
+	if tr2.Add("tester"); !tr2.Has("tester") {
+		t.Error("Expected the decoded Trie to accept new entries")
+	}
+}
+
+func TestBinaryConcatenated(t *testing.T) {
+	first, second := NewTrie(), NewTrie()
+	first.Add("first")
+	first.AddWithCount("foo", 3)
+	second.Add("second")
+
+	var buf bytes.Buffer
+	first.WriteTo(&buf)
+	second.WriteTo(&buf)
+	data := buf.Bytes()
+
+	// a bytes.Buffer is an io.ByteReader, the plain io.Reader is not
+	for name, r := range map[string]io.Reader{
+		"ByteReader": bytes.NewBuffer(data),
+		"Reader":     struct{ io.Reader }{bytes.NewReader(data)},
+	} {
+		tr1, tr2 := NewTrie(), NewTrie()
+		n1, err := tr1.ReadFrom(r)
+		if err != nil {
+			t.Fatalf("%s: Failed to read the first dump: %v", name, err)
+		}
+		n2, err := tr2.ReadFrom(r)
+		if err != nil {
+			t.Fatalf("%s: Failed to read the second dump: %v", name, err)
+		}
+		if n1+n2 != int64(len(data)) {
+			t.Errorf("%s: Expected ReadFrom to report %v bytes, got %v instead.", name, len(data), n1+n2)
+		}
+		if tr1.Dump() != first.Dump() || tr2.Dump() != second.Dump() {
+			t.Errorf("%s: Expected both dumps to be decoded, got\n%s\nand\n%s", name, tr1.Dump(), tr2.Dump())
+		}
+	}
+}
+
+func TestBinaryErrors(t *testing.T) {
+	tr := NewTrie()
+	tr.Add("test")
+	tr.Add("testing")
+	var buf bytes.Buffer
+	tr.WriteTo(&buf)
+	data := buf.Bytes()
+
+	tr2 := NewTrie()
+	tr2.Add("keep")
+
+	bad := append([]byte{}, data...)
+	bad[0] = 'X'
+	if _, err := tr2.ReadFrom(bytes.NewReader(bad)); err != ErrBadMagic {
+		t.Errorf("Expected ErrBadMagic, got %v instead.", err)
+	}
+
+	bad = append([]byte{}, data...)
+	bad[4] = binaryVersion + 1
+	if _, err := tr2.ReadFrom(bytes.NewReader(bad)); err != ErrUnsupportedVersion {
+		t.Errorf("Expected ErrUnsupportedVersion, got %v instead.", err)
+	}
+
+	bad = append([]byte{}, data...)
+	bad[len(bad)-1]++
+	if _, err := tr2.ReadFrom(bytes.NewReader(bad)); err != ErrChecksum {
+		t.Errorf("Expected ErrChecksum, got %v instead.", err)
+	}
+
+	if _, err := tr2.ReadFrom(bytes.NewReader(data[:len(data)-6])); err == nil {
+		t.Error("Expected an error for a truncated dump")
+	}
+
+	if !tr2.Has("keep") || tr2.Has("test") {
+		t.Error("Expected a failed ReadFrom to leave the Trie unchanged")
+	}
+}
@@ -2,6 +2,7 @@ package trie
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
 )
@@ -21,6 +22,15 @@ type Branch struct {
 	LeafValue []byte
 	End       bool
 	Count     int64
+	// MaxCount is the highest Count of any entry in the subtree of the Branch
+	// (including the Branch itself). It is maintained by add and delete.
+	MaxCount int64
+	// digest is a hash of all entries and counts in the subtree of the Branch
+	// (including its LeafValue). It is maintained next to MaxCount.
+	digest uint64
+	// Payload is an arbitrary value attached to the entry ending at the Branch.
+	// It is dropped when the entry is deleted.
+	Payload interface{}
 }
 
 /*
@@ -37,7 +47,16 @@ func (b *Branch) NewBranch() *Branch {
 Add adds an entry to the Branch
 */
 func (b *Branch) add(entry []byte) (addedBranch *Branch) {
-	if b.LeafValue == nil && len(b.Branches) == 0 {
+	// counts only grow when adding, so the MaxCount of the Branch can just be
+	// raised to the count of the added entry.
+	defer func() {
+		if addedBranch.Count > b.MaxCount {
+			b.MaxCount = addedBranch.Count
+		}
+	}()
+	// an empty branch. a branch that already marks an End (eg. an idx end like
+	// the 'a' in 'tea') must not take over the new entry as its LeafValue.
+	if len(b.LeafValue) == 0 && len(b.Branches) == 0 && !b.End {
 		if len(entry) > 0 {
 			b.LeafValue = entry
 		} else {
@@ -46,6 +65,7 @@ func (b *Branch) add(entry []byte) (addedBranch *Branch) {
 			// to push. just mark the current idx position as End
 		}
 		b.setEnd(true)
+		b.updateDigest()
 		addedBranch = b
 		return
 	}
@@ -78,6 +98,7 @@ func (b *Branch) add(entry []byte) (addedBranch *Branch) {
 		b.LeafValue = newLeaf
 		newBranch.Branches, b.Branches = b.Branches, newBranch.Branches
 		newBranch.End, b.End = b.End, newBranch.End
+		newBranch.Payload, b.Payload = b.Payload, nil
 		if newBranch.End {
 			if b.Count > 0 {
 				newBranch.Count = b.Count
@@ -92,7 +113,11 @@ func (b *Branch) add(entry []byte) (addedBranch *Branch) {
 		} else {
 			b.Count = 0
 		}
+		// the old subtree moved into the newBranch as a whole
+		newBranch.MaxCount = b.MaxCount
+		newBranch.updateDigest()
 		b.Branches[idx] = newBranch
+		b.updateDigest()
 	}
 
 	// new leaf is smaller than the entry, which means there will be more stuff
@@ -102,33 +127,161 @@ func (b *Branch) add(entry []byte) (addedBranch *Branch) {
 		idx := tail[0]
 
 		// create new branch at idx if it does not exists yet
-		if _, notPresent := b.Branches[idx]; !notPresent {
-			b.Branches[idx] = b.NewBranch()
+		br, present := b.Branches[idx]
+		if !present {
+			br = b.NewBranch()
+			b.Branches[idx] = br
+		}
+		// only the digest of the branch at idx changes. swap its part of the
+		// digest instead of recalculating all of it.
+		if present {
+			b.digest -= childDigest(idx, br)
 		}
 		// check whether the idx itself marks an End $. if so add a new idx
-		addedBranch = b.Branches[idx].add(tail[1:])
+		addedBranch = br.add(tail[1:])
+		b.digest += childDigest(idx, br)
 	} else {
 		// if there is nothing else to be pushed down we just have to mark the
 		// current branch as an end. this happens when you add a value that already
 		// is covered by the index but this particular end had not been marked.
 		// eg. you already have 'food' and 'foot' (shared LeafValue of 'foo') in
 		// your index and now add 'foo'.
+		b.digest -= b.ownDigest()
 		b.setEnd(true)
+		b.digest += b.ownDigest()
 		addedBranch = b
 	}
 	return addedBranch
 }
 
 /*
-Members returns slice of all Members of the Branch prepended with `branchPrefix`
+addCount adds an entry `n` times to the Branch. A `n` of zero or less does not
+change the Branch and returns nil.
+*/
+func (b *Branch) addCount(entry []byte, n int64) (addedBranch *Branch) {
+	if n <= 0 {
+		return nil
+	}
+	addedBranch = b.add(entry)
+	if n != 1 {
+		addedBranch.Count += n - 1
+		b.updateMaxCounts(entry)
+	}
+	return
+}
+
+/*
+setCount sets the count of an entry of the Branch to `n`. The entry is added
+if it does not exist yet and removed if `n` is zero or less.
+*/
+func (b *Branch) setCount(entry []byte, n int64) {
+	br := b.getBranch(entry)
+	switch {
+	case n <= 0:
+		if br != nil {
+			b.remove(entry)
+		}
+	case br == nil:
+		b.addCount(entry, n)
+	default:
+		br.Count = n
+		b.updateMaxCounts(entry)
+	}
+}
+
+/*
+remove removes an entry from the Branch regardless of its count.
+*/
+func (b *Branch) remove(entry []byte) bool {
+	br := b.getBranch(entry)
+	if br == nil {
+		return false
+	}
+	// a count of one makes delete drop the entry and compact the branches
+	br.Count = 1
+	return b.delete(entry)
+}
+
+/*
+deletePrefix removes all entries with the given prefix from the Branch and
+returns the number of removed entries and the sum of their counts. `drop` is
+true if the parent has to remove the whole Branch - because all of it matched
+the prefix or nothing is left of it.
+*/
+func (b *Branch) deletePrefix(prefix []byte) (entries int, count int64, drop bool) {
+	leafLen := len(b.LeafValue)
+	prefixLen := len(prefix)
+
+	// the prefix ends within the leaf - the whole branch has the prefix
+	if prefixLen <= leafLen {
+		for i, pb := range prefix {
+			if pb != b.LeafValue[i] {
+				return
+			}
+		}
+		entries, count = b.countEntries()
+		return entries, count, true
+	}
+
+	for i, lb := range b.LeafValue {
+		if prefix[i] != lb {
+			return
+		}
+	}
+	idx := prefix[leafLen]
+	nextBranch, present := b.Branches[idx]
+	if !present {
+		return
+	}
+	entries, count, drop = nextBranch.deletePrefix(prefix[leafLen+1:])
+	if drop {
+		delete(b.Branches, idx)
+	}
+	if entries == 0 {
+		return entries, count, false
+	}
+
+	// compact what is left
+	if len(b.Branches) == 0 && !b.End {
+		return entries, count, true
+	} else if len(b.Branches) == 1 && !b.End {
+		b.pullUp()
+	}
+	b.updateMaxCount()
+	return entries, count, false
+}
+
+/*
+countEntries returns the number of entries of the Branch and the sum of their
+counts.
 */
-func (b *Branch) members(branchPrefix []byte) (members []*MemberInfo) {
+func (b *Branch) countEntries() (entries int, count int64) {
 	if b.End {
+		entries, count = 1, b.Count
+	}
+	for _, br := range b.Branches {
+		e, c := br.countEntries()
+		entries += e
+		count += c
+	}
+	return
+}
+
+/*
+Members returns slice of all Members of the Branch prepended with `branchPrefix`.
+The members are in lexicographic (byte) order - or in reverse lexicographic
+order if `reverse` is true.
+*/
+func (b *Branch) members(branchPrefix []byte, reverse bool) (members []*MemberInfo) {
+	if b.End && !reverse {
 		members = append(members, &MemberInfo{string(append(branchPrefix, b.LeafValue...)), b.Count})
 	}
-	for idx, br := range b.Branches {
+	for _, idx := range b.sortedIdxs(reverse) {
 		newPrefix := append(append(branchPrefix, b.LeafValue...), idx)
-		members = append(members, br.members(newPrefix)...)
+		members = append(members, b.Branches[idx].members(newPrefix, reverse)...)
+	}
+	if b.End && reverse {
+		members = append(members, &MemberInfo{string(append(branchPrefix, b.LeafValue...)), b.Count})
 	}
 	return
 }
@@ -136,10 +289,10 @@ func (b *Branch) members(branchPrefix []byte) (members []*MemberInfo) {
 /*
 prefixMembers returns a slice of all Members of the Branch matching the given prefix. The values returned are prepended with `branchPrefix`
 */
-func (b *Branch) prefixMembers(branchPrefix []byte, searchPrefix []byte) (members []*MemberInfo) {
+func (b *Branch) prefixMembers(branchPrefix []byte, searchPrefix []byte, reverse bool) (members []*MemberInfo) {
 	exists, br, matchedPrefix := b.hasPrefixBranch(searchPrefix)
 	if exists {
-		members = br.members(matchedPrefix)
+		members = br.members(matchedPrefix, reverse)
 	}
 	return
 }
@@ -189,6 +342,11 @@ func (b *Branch) prefixMembers(branchPrefix []byte, searchPrefix []byte) (member
 /*
  */
 func (b *Branch) delete(entry []byte) (deleted bool) {
+	defer func() {
+		if deleted {
+			b.updateMaxCount()
+		}
+	}()
 	leafLen := len(b.LeafValue)
 	entryLen := len(entry)
 	// does the leafValue match?
@@ -236,6 +394,9 @@ func (b *Branch) delete(entry []byte) (deleted bool) {
 				// dangling leaf value?
 				if len(b.Branches) == 0 && b.Count == 0 {
 					b.LeafValue = nil
+				} else if len(b.Branches) == 1 && !b.End {
+					// only one branch left - merge it into this one
+					b.pullUp()
 				}
 			}
 			return deleted
@@ -288,6 +449,67 @@ func (b *Branch) getBranch(entry []byte) (be *Branch) {
 	return
 }
 
+/*
+prefixesOf returns all entries of the Branch that are a prefix of `entry`
+(including `entry` itself) ordered from the shortest to the longest. The values
+returned are prepended with `branchPrefix`.
+*/
+func (b *Branch) prefixesOf(branchPrefix []byte, entry []byte) (members []*MemberInfo) {
+	leafLen := len(b.LeafValue)
+	entryLen := len(entry)
+
+	if entryLen < leafLen {
+		return
+	}
+	for i, lb := range b.LeafValue {
+		if lb != entry[i] {
+			return
+		}
+	}
+
+	key := append(branchPrefix, b.LeafValue...)
+	if b.End {
+		members = append(members, &MemberInfo{string(key), b.Count})
+	}
+	if entryLen > leafLen {
+		if br, present := b.Branches[entry[leafLen]]; present {
+			members = append(members, br.prefixesOf(append(key, entry[leafLen]), entry[leafLen+1:])...)
+		}
+	}
+	return
+}
+
+/*
+longestPrefixOf returns the length and the count of the longest entry of the
+Branch that is a prefix of `entry`. `matched` is the number of bytes of the
+original entry that lead to this Branch.
+*/
+func (b *Branch) longestPrefixOf(entry []byte, matched int) (length int, count int64, ok bool) {
+	for {
+		leafLen := len(b.LeafValue)
+		if len(entry) < leafLen {
+			return
+		}
+		for i, lb := range b.LeafValue {
+			if lb != entry[i] {
+				return
+			}
+		}
+		matched += leafLen
+		if b.End {
+			length, count, ok = matched, b.Count, true
+		}
+		if len(entry) == leafLen {
+			return
+		}
+		br, present := b.Branches[entry[leafLen]]
+		if !present {
+			return
+		}
+		b, entry, matched = br, entry[leafLen+1:], matched+1
+	}
+}
+
 /*
  */
 func (b *Branch) hasPrefix(prefix []byte) bool {
@@ -365,7 +587,8 @@ func (b *Branch) Dump(depth int) (out string) {
 		out += fmt.Sprintf("%s $\n", strings.Repeat(PADDING_CHAR, depth+len(b.LeafValue)))
 	}
 
-	for idx, branch := range b.Branches {
+	for _, idx := range b.sortedIdxs(false) {
+		branch := b.Branches[idx]
 		if branch.End && len(branch.LeafValue) == 0 {
 			out += fmt.Sprintf("%s I:%v %v (%v)\n", strings.Repeat(PADDING_CHAR, depth+len(b.LeafValue)), string(idx), idx, branch.Count)
 		} else {
@@ -383,6 +606,23 @@ func (b *Branch) Dump(depth int) (out string) {
 // 	return len(b.Branches) == 0
 // }
 
+/*
+sortedIdxs returns the indexes of the Branches in ascending byte order - or in
+descending order if `reverse` is true.
+*/
+func (b *Branch) sortedIdxs(reverse bool) []byte {
+	idxs := make([]byte, 0, len(b.Branches))
+	for idx := range b.Branches {
+		idxs = append(idxs, idx)
+	}
+	if reverse {
+		sort.Slice(idxs, func(i, j int) bool { return idxs[i] > idxs[j] })
+	} else {
+		sort.Slice(idxs, func(i, j int) bool { return idxs[i] < idxs[j] })
+	}
+	return idxs
+}
+
 /*
  */
 func (b *Branch) hasBranch(idx byte) bool {
@@ -415,22 +655,111 @@ func (b *Branch) hasBranch(idx byte) bool {
 /*
  */
 func (b *Branch) pullUp() *Branch {
-	if len(b.Branches) == 1 {
+	// only a branch that does not mark an End itself can be merged with its
+	// single next branch
+	if len(b.Branches) == 1 && !b.End {
 		for k, nextBranch := range b.Branches {
-			if len(nextBranch.Branches) == 0 {
-				b.LeafValue = append(b.LeafValue, append([]byte{k}, nextBranch.LeafValue...)...)
-			} else {
-				b.LeafValue = append(b.LeafValue, k)
-			}
+			// build a new slice. the LeafValue might share its backing array
+			// with other branches.
+			leaf := make([]byte, 0, len(b.LeafValue)+1+len(nextBranch.LeafValue))
+			leaf = append(leaf, b.LeafValue...)
+			leaf = append(leaf, k)
+			b.LeafValue = append(leaf, nextBranch.LeafValue...)
 			b.End = nextBranch.End
 			b.Branches = nextBranch.Branches
 			b.Count = nextBranch.Count
+			b.Payload = nextBranch.Payload
 		}
+		b.updateDigest()
 		return b.pullUp()
 	}
 	return b
 }
 
+/*
+updateMaxCount recalculates the MaxCount of the Branch from its own Count and
+the MaxCount of its Branches - and its digest.
+*/
+func (b *Branch) updateMaxCount() {
+	var max int64
+	if b.End {
+		max = b.Count
+	}
+	for _, br := range b.Branches {
+		if br.MaxCount > max {
+			max = br.MaxCount
+		}
+	}
+	b.MaxCount = max
+	b.updateDigest()
+}
+
+/*
+updateDigest recalculates the digest of the Branch: the sum of its own digest
+and the digests of its Branches combined with their idx. A sum does not depend
+on the order in which the map returns the Branches and a changed Branch can be
+swapped out without recalculating the others - see add.
+*/
+func (b *Branch) updateDigest() {
+	d := b.ownDigest()
+	for idx, br := range b.Branches {
+		d += childDigest(idx, br)
+	}
+	b.digest = d
+}
+
+/*
+ownDigest returns the digest of the LeafValue, End and Count of the Branch. It
+is 0 if there is neither a LeafValue nor an End - so an empty Branch has the
+digest 0 like a new one.
+*/
+func (b *Branch) ownDigest() uint64 {
+	if len(b.LeafValue) == 0 && !b.End {
+		return 0
+	}
+	d := uint64(len(b.LeafValue))
+	for _, lb := range b.LeafValue {
+		d = mix64(d ^ uint64(lb))
+	}
+	if b.End {
+		d = mix64(d ^ uint64(b.Count) ^ 1<<63)
+	}
+	return mix64(d)
+}
+
+/*
+childDigest returns the part of the digest of a Branch that comes from its
+Branch `br` at `idx`.
+*/
+func childDigest(idx byte, br *Branch) uint64 {
+	return mix64(br.digest ^ uint64(idx)<<56)
+}
+
+/*
+mix64 is the finalizer of splitmix64 - a cheap bijective mixing function.
+*/
+func mix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ x>>30) * 0xbf58476d1ce4e5b9
+	x = (x ^ x>>27) * 0x94d049bb133111eb
+	return x ^ x>>31
+}
+
+/*
+updateMaxCounts recalculates the MaxCount of all Branches along the path of
+`entry`. It needs to be called after the Count of the entry was changed
+directly.
+*/
+func (b *Branch) updateMaxCounts(entry []byte) {
+	leafLen := len(b.LeafValue)
+	if len(entry) > leafLen {
+		if br, present := b.Branches[entry[leafLen]]; present {
+			br.updateMaxCounts(entry[leafLen+1:])
+		}
+	}
+	b.updateMaxCount()
+}
+
 func (b *Branch) setEnd(flag bool) {
 	if flag {
 		b.Count += 1
@@ -443,6 +772,9 @@ func (b *Branch) setEnd(flag bool) {
 		}
 	}
 	b.End = flag
+	if !flag {
+		b.Payload = nil
+	}
 	return
 }
 
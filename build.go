@@ -0,0 +1,93 @@
+package trie
+
+import (
+	"errors"
+	"fmt"
+)
+
+/*
+NewTrieFromSorted builds a new Trie from `entries`, which have to be in
+lexicographic (byte) order. Duplicate entries are counted like repeated calls
+of Add. The Branches are built bottom-up in a single pass, which is a lot
+faster than adding the entries one by one.
+*/
+func NewTrieFromSorted(entries []string) (*Trie, error) {
+	var members []*MemberInfo
+	for i, entry := range entries {
+		if i > 0 && entry < entries[i-1] {
+			return nil, errors.New(fmt.Sprintf("Entries are not sorted: %q comes after %q", entry, entries[i-1]))
+		}
+		if len(members) > 0 && members[len(members)-1].Value == entry {
+			members[len(members)-1].Count++
+		} else {
+			members = append(members, &MemberInfo{entry, 1})
+		}
+	}
+
+	t := NewTrie()
+	if len(members) > 0 {
+		t.Root = buildBranch(members, 0)
+	}
+	return t, nil
+}
+
+/*
+buildFromSortedMembers builds a root Branch from `members`. It returns nil if
+the members are not in strictly increasing lexicographic order or have counts
+below one.
+*/
+func buildFromSortedMembers(members []*MemberInfo) *Branch {
+	for i, mi := range members {
+		if mi.Count < 1 || (i > 0 && mi.Value <= members[i-1].Value) {
+			return nil
+		}
+	}
+	if len(members) == 0 {
+		return NewTrie().Root
+	}
+	return buildBranch(members, 0)
+}
+
+/*
+buildBranch builds the Branch for `members`, which are sorted, unique and share
+their first `depth` bytes. The LeafValue of the Branch is the longest common
+prefix of the rest of the members, the members that end there mark the End of
+the Branch and all others are grouped into Branches by their next byte.
+*/
+func buildBranch(members []*MemberInfo, depth int) *Branch {
+	b := &Branch{
+		Branches: make(map[byte]*Branch),
+	}
+
+	// members are sorted - so the common prefix of the first and the last is
+	// the common prefix of all of them
+	first, last := members[0].Value, members[len(members)-1].Value
+	leafEnd := depth
+	for leafEnd < len(first) && leafEnd < len(last) && first[leafEnd] == last[leafEnd] {
+		leafEnd++
+	}
+	if leafEnd > depth {
+		b.LeafValue = []byte(first[depth:leafEnd])
+	}
+
+	// an entry that ends here is the first one since it is a prefix of all others
+	if len(first) == leafEnd {
+		b.End = true
+		b.Count = members[0].Count
+		members = members[1:]
+	}
+
+	// group the remaining members by their next byte
+	for start := 0; start < len(members); {
+		idx := members[start].Value[leafEnd]
+		end := start + 1
+		for end < len(members) && members[end].Value[leafEnd] == idx {
+			end++
+		}
+		b.Branches[idx] = buildBranch(members[start:end], leafEnd+1)
+		start = end
+	}
+
+	b.updateMaxCount()
+	return b
+}
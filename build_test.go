@@ -0,0 +1,87 @@
+package trie
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestNewTrieFromSorted(t *testing.T) {
+	var words []string
+	for n := 0; n < 2000; n++ {
+		str := []byte{}
+		for i := 0; i < rand.Intn(8); i++ {
+			str = append(str, byte('a'+rand.Intn(4)))
+		}
+		words = append(words, string(str))
+	}
+	words = append(words, "日本", "日本語", "日本語学校", "学校")
+
+	ref := NewTrie()
+	for _, w := range words {
+		ref.Add(w)
+	}
+	sort.Strings(words)
+	tr, err := NewTrieFromSorted(words)
+	if err != nil {
+		t.Fatalf("Failed to build Trie: %v", err)
+	}
+
+	if tr.Dump() != ref.Dump() {
+		t.Error("Expected the built Trie to have the same structure as the one built with Add")
+	}
+	if tr.Root.MaxCount != ref.Root.MaxCount {
+		t.Errorf("Expected MaxCount %v, got %v instead.", ref.Root.MaxCount, tr.Root.MaxCount)
+	}
+
+	// the built Trie has to work like any other
+	tr.Add("dcba")
+	tr.Delete("日本")
+	if !tr.Has("dcba") || tr.Has("日本") || !tr.Has("日本語") {
+		t.Error("Unexpected Has result after modifying the built Trie")
+	}
+}
+
+func TestNewTrieFromSortedEdgeCases(t *testing.T) {
+	tr, err := NewTrieFromSorted(nil)
+	if err != nil || len(tr.Members()) != 0 {
+		t.Errorf("Expected an empty Trie, got %v %v instead.", tr.Members(), err)
+	}
+
+	tr, err = NewTrieFromSorted([]string{"test"})
+	if err != nil || !tr.Root.End || string(tr.Root.LeafValue) != "test" {
+		t.Errorf("Expected the Root to hold test, got %v instead.", tr.Dump())
+	}
+
+	tr, err = NewTrieFromSorted([]string{"test", "test", "test", "tests"})
+	if err != nil {
+		t.Fatalf("Failed to build Trie: %v", err)
+	}
+	if _, c := tr.HasCount("test"); c != 3 {
+		t.Errorf("Expected count for test to be 3. got %v instead.", c)
+	}
+
+	if _, err = NewTrieFromSorted([]string{"b", "a"}); err == nil {
+		t.Error("Expected NewTrieFromSorted to fail for unsorted entries")
+	}
+}
+
+func BenchmarkTrieBenchNewTrieFromSorted(b *testing.B) {
+	b.StopTimer()
+	words := append([]string{}, randstrings[:100000]...)
+	sort.Strings(words)
+	b.StartTimer()
+	for x := 0; x < b.N; x++ {
+		NewTrieFromSorted(words)
+	}
+}
+
+func BenchmarkTrieBenchAddBatch(b *testing.B) {
+	b.StopTimer()
+	words := append([]string{}, randstrings[:100000]...)
+	sort.Strings(words)
+	b.StartTimer()
+	for x := 0; x < b.N; x++ {
+		NewTrie().AddBatch(words)
+	}
+}
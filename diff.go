@@ -0,0 +1,247 @@
+package trie
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+/*
+ChangeKind tells how an entry differs between two Tries.
+*/
+type ChangeKind byte
+
+const (
+	Added   ChangeKind = '+'
+	Removed ChangeKind = '-'
+	Changed ChangeKind = '~'
+
+	patchMaxLine = 1 << 26
+)
+
+/*
+Change is a difference between two Tries found by Diff. OldCount is 0 for
+Added entries, NewCount is 0 for Removed entries.
+*/
+type Change struct {
+	Kind     ChangeKind
+	Key      string
+	OldCount int64
+	NewCount int64
+}
+
+/*
+String returns the Change as a line of a patch - see WritePatch.
+*/
+func (c Change) String() string {
+	switch c.Kind {
+	case Added:
+		return fmt.Sprintf("+ %s %d", strconv.Quote(c.Key), c.NewCount)
+	case Removed:
+		return fmt.Sprintf("- %s %d", strconv.Quote(c.Key), c.OldCount)
+	default:
+		return fmt.Sprintf("~ %s %d %d", strconv.Quote(c.Key), c.OldCount, c.NewCount)
+	}
+}
+
+/*
+Diff walks `old` and `new` at the same time and calls `fn` for every entry
+that was added, removed or whose count changed in lexicographic (byte) order.
+Returning false from `fn` stops the walk. A subtree that only exists in one of
+the Tries is walked on its own. Subtrees that exist in both are compared by
+the digests of their Branches first and skipped if they are identical, so only
+the paths to the changed entries are walked.
+
+Both Tries are read locked during the walk, so `fn` must not change them.
+*/
+func Diff(old, new *Trie, fn func(c Change) bool) {
+	if new == old {
+		return
+	}
+	defer rlockBoth(old, new)()
+
+	diffWalk(setCursor{old.Root, 0}, setCursor{new.Root, 0}, []byte{}, fn)
+}
+
+/*
+WritePatch writes the differences between `old` and `new` to `w` as a human
+readable patch that ApplyPatch can replay. Every line holds one Change - see
+Change.String: the kind (+, - or ~), the key quoted like a Go string and the
+count of the key, or the old and the new count for a changed key. Example:
+
+	~ "test" 2 3
+	+ "toast" 1
+*/
+func WritePatch(w io.Writer, old, new *Trie) (err error) {
+	bw := bufio.NewWriter(w)
+	Diff(old, new, func(c Change) bool {
+		_, err = fmt.Fprintln(bw, c)
+		return err == nil
+	})
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err != nil {
+		err = errors.New(fmt.Sprintf("Could not write patch: %v", err))
+	}
+	return
+}
+
+/*
+ApplyPatch replays a patch written by WritePatch. Empty lines and lines
+starting with # are ignored. The patch is checked against the Trie before
+anything is changed: added entries must not exist and removed or changed
+entries must have the old count. If a line does not apply the Trie is left
+unchanged and an error is returned.
+*/
+func (t *Trie) ApplyPatch(r io.Reader) (err error) {
+	var changes []Change
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, patchMaxLine)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if len(text) == 0 || text[0] == '#' {
+			continue
+		}
+		c, parseErr := parseChange(text)
+		if parseErr != nil {
+			return errors.New(fmt.Sprintf("Could not parse patch line %d: %v", line, parseErr))
+		}
+		changes = append(changes, c)
+	}
+	if err = scanner.Err(); err != nil {
+		return errors.New(fmt.Sprintf("Could not read patch: %v", err))
+	}
+
+	t.Root.Lock()
+	defer t.Root.Unlock()
+
+	// counts after the changes checked so far
+	counts := make(map[string]int64)
+	for _, c := range changes {
+		count, seen := counts[c.Key]
+		if !seen {
+			_, count = t.Root.hasCount([]byte(c.Key))
+		}
+		if count != c.OldCount {
+			return errors.New(fmt.Sprintf("Patch does not apply: %v - the count is %d", c, count))
+		}
+		counts[c.Key] = c.NewCount
+	}
+	for _, c := range changes {
+		t.Root.setCount([]byte(c.Key), c.NewCount)
+		t.logOp(walSetCount, c.Key, c.NewCount)
+	}
+	return
+}
+
+/*
+parseChange parses a line of a patch.
+*/
+func parseChange(line string) (c Change, err error) {
+	if len(line) < 2 || line[1] != ' ' {
+		return c, errors.New("missing change kind")
+	}
+	c.Kind = ChangeKind(line[0])
+	if c.Kind != Added && c.Kind != Removed && c.Kind != Changed {
+		return c, errors.New(fmt.Sprintf("unknown change kind %q", line[0]))
+	}
+	rest := line[2:]
+	quoted, err := strconv.QuotedPrefix(rest)
+	if err != nil {
+		return c, errors.New("missing quoted key")
+	}
+	if c.Key, err = strconv.Unquote(quoted); err != nil {
+		return
+	}
+
+	fields := strings.Fields(rest[len(quoted):])
+	numbers := make([]int64, len(fields))
+	for i, f := range fields {
+		if numbers[i], err = strconv.ParseInt(f, 10, 64); err != nil || numbers[i] < 1 {
+			return c, errors.New(fmt.Sprintf("invalid count %q", f))
+		}
+	}
+	switch {
+	case c.Kind == Added && len(numbers) == 1:
+		c.NewCount = numbers[0]
+	case c.Kind == Removed && len(numbers) == 1:
+		c.OldCount = numbers[0]
+	case c.Kind == Changed && len(numbers) == 2:
+		c.OldCount, c.NewCount = numbers[0], numbers[1]
+	default:
+		return c, errors.New("wrong number of counts")
+	}
+	return
+}
+
+/*
+diffWalk compares the positions `a` in the old and `b` in the new Trie, which
+are both reached by `key`.
+*/
+func diffWalk(a, b setCursor, key []byte, fn func(c Change) bool) bool {
+	// identical subtrees have the same digest
+	if a.off == 0 && b.off == 0 && a.b.digest == b.b.digest {
+		return true
+	}
+	for !a.atBranch() && !b.atBranch() && a.b.LeafValue[a.off] == b.b.LeafValue[b.off] {
+		key = append(key, a.b.LeafValue[a.off])
+		a.off++
+		b.off++
+	}
+
+	endA, endB := a.atBranch() && a.b.End, b.atBranch() && b.b.End
+	switch {
+	case endA && endB:
+		if a.b.Count != b.b.Count && !fn(Change{Changed, string(key), a.b.Count, b.b.Count}) {
+			return false
+		}
+	case endA:
+		if !fn(Change{Removed, string(key), a.b.Count, 0}) {
+			return false
+		}
+	case endB:
+		if !fn(Change{Added, string(key), 0, b.b.Count}) {
+			return false
+		}
+	}
+
+	idxsA, nextA := a.next()
+	idxsB, nextB := b.next()
+	i, j := 0, 0
+	for i < len(idxsA) || j < len(idxsB) {
+		var ok bool
+		switch {
+		case j == len(idxsB) || (i < len(idxsA) && idxsA[i] < idxsB[j]):
+			ok = diffSubtree(nextA[i], append(key, idxsA[i]), func(k string, count int64) bool {
+				return fn(Change{Removed, k, count, 0})
+			})
+			i++
+		case i == len(idxsA) || idxsB[j] < idxsA[i]:
+			ok = diffSubtree(nextB[j], append(key, idxsB[j]), func(k string, count int64) bool {
+				return fn(Change{Added, k, 0, count})
+			})
+			j++
+		default:
+			ok = diffWalk(nextA[i], nextB[j], append(key, idxsA[i]), fn)
+			i++
+			j++
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+diffSubtree walks all entries below the position `c` that is reached by `key`.
+*/
+func diffSubtree(c setCursor, key []byte, fn func(key string, count int64) bool) bool {
+	// walk prepends the whole LeafValue, key already contains its first c.off
+	// bytes
+	return c.b.walk(append([]byte{}, key[:len(key)-c.off]...), fn)
+}
@@ -0,0 +1,253 @@
+package trie
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestTrieDiff(t *testing.T) {
+	old, new := NewTrie(), NewTrie()
+	old.AddWithCount("test", 2)
+	old.Add("tea")
+	old.Add("testing")
+	old.Add("日本")
+	new.AddWithCount("test", 3)
+	new.Add("tea")
+	new.Add("toast")
+	new.Add("日本語")
+	new.Add("with \"quotes\"\nand a newline")
+
+	var changes []string
+	Diff(old, new, func(c Change) bool {
+		changes = append(changes, c.String())
+		return true
+	})
+	expected := []string{
+		`~ "test" 2 3`,
+		`- "testing" 1`,
+		`+ "toast" 1`,
+		`+ "with \"quotes\"\nand a newline" 1`,
+		`- "日本" 1`,
+		`+ "日本語" 1`,
+	}
+	if strings.Join(changes, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected changes\n%s\ngot\n%s\ninstead.", strings.Join(expected, "\n"), strings.Join(changes, "\n"))
+	}
+
+	n := 0
+	Diff(old, new, func(c Change) bool {
+		n++
+		return n < 2
+	})
+	if n != 2 {
+		t.Errorf("Expected Diff to stop after 2 changes, got %v instead.", n)
+	}
+
+	Diff(old, old, func(c Change) bool {
+		t.Errorf("Expected no changes between a Trie and itself, got %v", c)
+		return true
+	})
+
+	var patch bytes.Buffer
+	if err := WritePatch(&patch, old, new); err != nil {
+		t.Fatalf("Failed to write patch: %v", err)
+	}
+	if err := old.ApplyPatch(strings.NewReader("# a comment\n\n" + patch.String())); err != nil {
+		t.Fatalf("Failed to apply patch: %v", err)
+	}
+	if old.Dump() != new.Dump() {
+		t.Errorf("Expected the patched Trie to equal the new one, got\n%s\ninstead of\n%s", old.Dump(), new.Dump())
+	}
+
+	// the patch does not apply a second time - nothing must change
+	before := old.Dump()
+	if err := old.ApplyPatch(bytes.NewReader(patch.Bytes())); err == nil {
+		t.Error("Expected ApplyPatch to fail on a Trie it does not apply to")
+	}
+	if old.Dump() != before {
+		t.Error("Expected a failed ApplyPatch to leave the Trie unchanged")
+	}
+
+	for _, bad := range []string{"x \"foo\" 1", "+ foo 1", "+ \"foo\"", "~ \"foo\" 1", "- \"foo\" 0", "+ \"foo\" 1 2"} {
+		if err := NewTrie().ApplyPatch(strings.NewReader(bad)); err == nil {
+			t.Errorf("Expected ApplyPatch to fail on %q", bad)
+		}
+	}
+}
+
+func TestTrieDiffRandom(t *testing.T) {
+	for round := 0; round < 20; round++ {
+		old, new := NewTrie(), NewTrie()
+		for _, tr := range []*Trie{old, new} {
+			for n := 0; n < 200; n++ {
+				str := []byte{}
+				for i := 0; i < 1+rand.Intn(6); i++ {
+					str = append(str, byte('a'+rand.Intn(3)))
+				}
+				tr.Add(string(str))
+			}
+		}
+
+		var count int
+		var last string
+		Diff(old, new, func(c Change) bool {
+			if count > 0 && c.Key <= last {
+				t.Errorf("Expected changes in lexicographic order, got %s after %s", c.Key, last)
+			}
+			_, oc := old.HasCount(c.Key)
+			_, nc := new.HasCount(c.Key)
+			if oc != c.OldCount || nc != c.NewCount || oc == nc {
+				t.Errorf("Unexpected change %v - counts are %v and %v", c, oc, nc)
+			}
+			last = c.Key
+			count++
+			return true
+		})
+
+		var patch bytes.Buffer
+		WritePatch(&patch, old, new)
+		if err := old.ApplyPatch(&patch); err != nil {
+			t.Fatalf("Failed to apply patch: %v", err)
+		}
+		if old.Dump() != new.Dump() {
+			t.Fatal("Expected the patched Trie to equal the new one")
+		}
+	}
+}
+
+func TestTrieDiffConcurrent(t *testing.T) {
+	old, new := NewTrie(), NewTrie()
+	words := []string{"foodie", "foods", "foodchain", "food", "日本", "日本語"}
+	wg := sync.WaitGroup{}
+	// both argument orders while writers wait for the locks
+	for n := 0; n < 4; n++ {
+		wg.Add(3)
+		go func() {
+			for i := 0; i < 200; i++ {
+				old.Add(words[i%len(words)])
+				new.Add(words[(i+1)%len(words)])
+			}
+			wg.Done()
+		}()
+		go func() {
+			for i := 0; i < 200; i++ {
+				Diff(old, new, func(c Change) bool { return true })
+			}
+			wg.Done()
+		}()
+		go func() {
+			for i := 0; i < 200; i++ {
+				Diff(new, old, func(c Change) bool { return true })
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+}
+
+/*
+checkDigests recalculates the digests of all Branches below `b` and reports
+the ones that differ from the maintained digest.
+*/
+func checkDigests(t *testing.T, b *Branch, key string) {
+	key += string(b.LeafValue)
+	for idx, br := range b.Branches {
+		checkDigests(t, br, key+string([]byte{idx}))
+	}
+	c := &Branch{Branches: b.Branches, LeafValue: b.LeafValue, End: b.End, Count: b.Count}
+	c.updateDigest()
+	if c.digest != b.digest {
+		t.Errorf("Expected the digest of the Branch at %q to be %x, got %x instead.", key, c.digest, b.digest)
+	}
+}
+
+func TestTrieDigestRandom(t *testing.T) {
+	randomWord := func() string {
+		str := []byte{}
+		for i := 0; i < 1+rand.Intn(6); i++ {
+			str = append(str, byte('a'+rand.Intn(3)))
+		}
+		return string(str)
+	}
+	tr, other := NewTrie(), NewTrie()
+	for n := 0; n < 100; n++ {
+		other.AddWithCount(randomWord(), int64(1+rand.Intn(3)))
+	}
+	for n := 0; n < 2000; n++ {
+		switch w := randomWord(); rand.Intn(9) {
+		case 0:
+			tr.AddWithCount(w, int64(1+rand.Intn(3)))
+		case 1:
+			tr.Delete(w)
+		case 2:
+			tr.SetCount(w, int64(rand.Intn(3)))
+		case 3:
+			tr.Remove(w)
+		case 4:
+			tr.DeletePrefix(w[:1+rand.Intn(len(w))])
+		case 5:
+			tr.Increment(w, int64(rand.Intn(5)-2))
+		case 6:
+			tr.Put(w, n)
+		case 7:
+			if rand.Intn(20) == 0 {
+				tr.Merge(other, MergeMax)
+			}
+		default:
+			tr.Add(w)
+		}
+		checkDigests(t, tr.Root, "")
+		if t.Failed() {
+			t.Fatalf("Digests differ after operation %v", n)
+		}
+	}
+
+	var buf bytes.Buffer
+	tr.WriteTo(&buf)
+	read := NewTrie()
+	read.ReadFrom(&buf)
+	built := &Trie{Root: buildFromSortedMembers(tr.Members())}
+	for _, res := range []*Trie{read, built, Union(tr, other), Intersect(tr, other), Difference(tr, other), Difference(other, tr)} {
+		checkDigests(t, res.Root, "")
+	}
+	if read.Root.digest != tr.Root.digest || built.Root.digest != tr.Root.digest {
+		t.Error("Expected a Trie read back or built from its members to have the same digest as the original")
+	}
+	if u := Union(other, tr); u.Root.digest != Union(tr, other).Root.digest {
+		t.Error("Expected Tries with the same entries to have the same digest")
+	}
+
+	p := NewPersistentTrie()
+	for n := 0; n < 500; n++ {
+		if w := randomWord(); rand.Intn(3) == 0 {
+			p.Delete(w)
+		} else {
+			p.Add(w)
+		}
+	}
+	checkDigests(t, p.load(), "")
+}
+
+func TestTrieDiffSkipsIdentical(t *testing.T) {
+	old, new := NewTrie(), NewTrie()
+	for _, w := range []string{"foo", "food", "foot", "bar", "baz", "日本", "日本語"} {
+		old.Add(w)
+		new.Add(w)
+	}
+	new.SetCount("bar", 3)
+
+	// change a count behind the back of the digests - a subtree with a
+	// matching digest is not walked, so the change is not found
+	new.Root.getBranch([]byte("food")).Count = 5
+	var changes []string
+	Diff(old, new, func(c Change) bool {
+		changes = append(changes, c.String())
+		return true
+	})
+	if len(changes) != 1 || changes[0] != `~ "bar" 1 3` {
+		t.Errorf("Expected Diff to only walk the changed subtree and find [~ \"bar\" 1 3], got %v instead.", changes)
+	}
+}
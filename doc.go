@@ -10,5 +10,21 @@ Branch - A Branch might have a LeafValue or not and might have other Branches sp
 Entry - an entry refers to a _complete_ term that is inserted, removed from, or matched in the index. It requires `End` on the Branch to be set to `true`, which makes it different from a
 
 Prefix - which does not require the Branch to have End set to `true` to match.
+
+RuneTrie - A Trie whose Branches split off by rune instead of by byte, so entries and prefixes are only ever split on character boundaries.
+
+Concurrency
+
+A Trie is safe for concurrent use by multiple goroutines. All methods that
+modify the Trie (Add, Delete, Put, Update, MergeFromFile) take the write lock of
+the Root Branch, all methods that only read from it (Has, HasPrefix, Members,
+PrefixMembers, Walk, ...) take its read lock. Only the Root Branch is locked -
+the locks of the other Branches are not used.
+
+Callbacks (Walk, Update) run while the Trie is locked and must not call methods
+of the Trie. An Iterator only read locks the Trie within Next, the Trie may be
+changed between two calls.
+Branches returned by Add or GetBranch are part of the Trie and must not be
+accessed while other goroutines modify it.
 */
 package trie
@@ -0,0 +1,374 @@
+package trie
+
+import (
+	"bytes"
+	"container/heap"
+	"fmt"
+	"sort"
+)
+
+/*
+FuzzyMatch is an entry found by a fuzzy search together with its count and its
+edit distance to the query.
+*/
+type FuzzyMatch struct {
+	Value    string
+	Count    int64
+	Distance int
+}
+
+func (m *FuzzyMatch) String() string {
+	return fmt.Sprintf("%s(%v)~%v", m.Value, m.Count, m.Distance)
+}
+
+/*
+FuzzyMembers returns all entries of the Trie that are within a Levenshtein
+distance of `maxDist` of `query` as FuzzyMatch. The distance is measured in
+bytes. The matches are ordered by their distance and within the same distance
+in lexicographic (byte) order.
+*/
+func (t *Trie) FuzzyMembers(query string, maxDist int) []*FuzzyMatch {
+	return t.fuzzyMembers(query, maxDist, false)
+}
+
+/*
+FuzzyMembersRunes works like FuzzyMembers but measures the distance in runes
+instead of bytes - so replacing 日 with 月 is one edit and not three.
+*/
+func (t *Trie) FuzzyMembersRunes(query string, maxDist int) []*FuzzyMatch {
+	return t.fuzzyMembers(query, maxDist, true)
+}
+
+func (t *Trie) fuzzyMembers(query string, maxDist int, runes bool) []*FuzzyMatch {
+	t.Root.RLock()
+	defer t.Root.RUnlock()
+	if maxDist < 0 {
+		return nil
+	}
+	fs := newFuzzySearch(query, maxDist, runes)
+	fs.walker().walk(t.Root, []byte{}, 0, fs.firstRow())
+	sort.SliceStable(fs.matches, func(i, j int) bool {
+		return fs.matches[i].Distance < fs.matches[j].Distance
+	})
+	return fs.matches
+}
+
+/*
+FuzzyPrefixMembers returns entries of the Trie that have a prefix within a
+Levenshtein distance of `maxDist` of `prefix` as FuzzyMatch - the typo tolerant
+version of PrefixMembers. The distance of an entry is the smallest distance of
+any of its prefixes. The distance is measured in bytes.
+
+The matches are ordered by their distance, then by their count (highest first)
+and then lexicographically. At most `limit` matches are returned, a `limit` of
+zero or less returns all of them. The search stops as soon as `limit` matches
+are found, so a small limit only visits a small part of the Trie.
+*/
+func (t *Trie) FuzzyPrefixMembers(prefix string, maxDist int, limit int) []*FuzzyMatch {
+	return t.fuzzyPrefixMembers(prefix, maxDist, limit, false)
+}
+
+/*
+FuzzyPrefixMembersRunes works like FuzzyPrefixMembers but measures the distance
+in runes instead of bytes.
+*/
+func (t *Trie) FuzzyPrefixMembersRunes(prefix string, maxDist int, limit int) []*FuzzyMatch {
+	return t.fuzzyPrefixMembers(prefix, maxDist, limit, true)
+}
+
+func (t *Trie) fuzzyPrefixMembers(prefix string, maxDist int, limit int, runes bool) []*FuzzyMatch {
+	t.Root.RLock()
+	defer t.Root.RUnlock()
+	if maxDist < 0 {
+		return nil
+	}
+	fs := newFuzzySearch(prefix, maxDist, runes)
+	fs.searchPrefix(t.Root, limit)
+	return fs.matches
+}
+
+/*
+fuzzySearch holds the state of a fuzzy search. The query is kept as a slice of
+symbols - one per byte or one per rune depending on `runes`.
+*/
+type fuzzySearch struct {
+	query   []rune
+	maxDist int
+	runes   bool
+	matches []*FuzzyMatch
+	// the number of items taken off the heap by searchPrefix
+	visited int
+}
+
+func newFuzzySearch(query string, maxDist int, runes bool) *fuzzySearch {
+	fs := &fuzzySearch{
+		maxDist: maxDist,
+		runes:   runes,
+	}
+	if runes {
+		fs.query = []rune(query)
+	} else {
+		for _, qb := range []byte(query) {
+			fs.query = append(fs.query, rune(qb))
+		}
+	}
+	return fs
+}
+
+/*
+firstRow returns the edit distances of all prefixes of the query to the empty
+string.
+*/
+func (fs *fuzzySearch) firstRow() []int {
+	row := make([]int, len(fs.query)+1)
+	for i := range row {
+		row[i] = i
+	}
+	return row
+}
+
+/*
+walker returns the runeWalker that collects all matches. Its state is the row
+of edit distances for the key walked so far.
+*/
+func (fs *fuzzySearch) walker() *runeWalker[[]int] {
+	return &runeWalker[[]int]{
+		bytes: !fs.runes,
+		step: func(row []int, sym rune) ([]int, walkAction) {
+			if next := fs.step(row, sym); next != nil {
+				return next, walkDescend
+			}
+			return nil, walkSkip
+		},
+		entry: func(row []int, key string, count int64) {
+			if row[len(row)-1] <= fs.maxDist {
+				fs.matches = append(fs.matches, &FuzzyMatch{key, count, row[len(row)-1]})
+			}
+		},
+	}
+}
+
+/*
+fuzzyPrefixState is the state of a prefix search: the row of edit distances for
+the key walked so far and the smallest distance of any of its prefixes.
+*/
+type fuzzyPrefixState struct {
+	row  []int
+	best int
+}
+
+/*
+prefixStep advances a prefix search by the symbol `sym`. Once no longer prefix
+can get within the maximum distance anymore the distance of every entry below
+is the best distance so far and the subtree is taken as a whole.
+*/
+func (fs *fuzzySearch) prefixStep(st *fuzzyPrefixState, sym rune) (*fuzzyPrefixState, walkAction) {
+	next := fs.step(st.row, sym)
+	if next == nil {
+		return nil, walkTake
+	}
+	return &fuzzyPrefixState{next, minInt(st.best, next[len(next)-1])}, walkDescend
+}
+
+/*
+searchPrefix collects up to `limit` entries below `root` that have a prefix
+within the maximum distance of the query - or all of them for a `limit` of zero
+or less - in the order of FuzzyPrefixMembers.
+
+Instead of walking the whole Trie it expands the subtrees best first: a subtree
+is ranked by the lowest distance any entry below it can have and its MaxCount,
+so the search stops as soon as `limit` entries are found.
+*/
+func (fs *fuzzySearch) searchPrefix(root *Branch, limit int) {
+	w := &runeWalker[*fuzzyPrefixState]{
+		bytes: !fs.runes,
+		step:  fs.prefixStep,
+	}
+	row := fs.firstRow()
+	h := &fuzzyHeap{}
+	fs.pushBranch(h, root, []byte{}, 0, &fuzzyPrefixState{row, row[len(row)-1]})
+	for h.Len() > 0 && (limit <= 0 || len(fs.matches) < limit) {
+		item := heap.Pop(h).(*fuzzyItem)
+		fs.visited++
+		switch {
+		case item.branch == nil:
+			fs.matches = append(fs.matches, &FuzzyMatch{string(item.key), item.count, item.dist})
+		case item.st == nil:
+			fs.expandTaken(h, item)
+		default:
+			fs.expand(h, w, item)
+		}
+	}
+}
+
+/*
+expand follows the LeafValue of the Branch of `item` and pushes its entry and
+its children.
+*/
+func (fs *fuzzySearch) expand(h *fuzzyHeap, w *runeWalker[*fuzzyPrefixState], item *fuzzyItem) {
+	b, st, pending := item.branch, item.st, item.pending
+	key := append([]byte{}, item.key...)
+	for _, lb := range b.LeafValue {
+		key = append(key, lb)
+		next, nextPending, action := w.feed(key[len(key)-pending-1:], st, false)
+		if action == walkTake {
+			fs.pushTaken(h, b, item.key, next.best)
+			return
+		}
+		st, pending = next, nextPending
+	}
+	if b.End {
+		next, _, action := w.feed(key[len(key)-pending:], st, true)
+		if action == walkTake {
+			fs.pushTaken(h, b, item.key, next.best)
+			return
+		}
+		if next.best <= fs.maxDist {
+			heap.Push(h, &fuzzyItem{key: key, count: b.Count, dist: next.best})
+		}
+	}
+	for idx, child := range b.Branches {
+		nextKey := append(append(make([]byte, 0, len(key)+1), key...), idx)
+		next, nextPending, action := w.feed(nextKey[len(nextKey)-pending-1:], st, false)
+		if action == walkTake {
+			fs.pushTaken(h, child, nextKey, next.best)
+		} else {
+			fs.pushBranch(h, child, nextKey, nextPending, next)
+		}
+	}
+}
+
+/*
+expandTaken pushes the entry and the children of the Branch of `item` - all of
+them with the distance of the item.
+*/
+func (fs *fuzzySearch) expandTaken(h *fuzzyHeap, item *fuzzyItem) {
+	b := item.branch
+	key := append(append([]byte{}, item.key...), b.LeafValue...)
+	if b.End {
+		heap.Push(h, &fuzzyItem{key: key, count: b.Count, dist: item.dist})
+	}
+	for idx, child := range b.Branches {
+		nextKey := append(append(make([]byte, 0, len(key)+1), key...), idx)
+		fs.pushTaken(h, child, nextKey, item.dist)
+	}
+}
+
+/*
+pushBranch pushes the Branch `b` that is reached with `key` in state `st`. The
+lowest distance an entry below it can have is the best distance so far or the
+lowest distance in the row - whichever is lower.
+*/
+func (fs *fuzzySearch) pushBranch(h *fuzzyHeap, b *Branch, key []byte, pending int, st *fuzzyPrefixState) {
+	dist := st.best
+	for _, d := range st.row {
+		dist = minInt(dist, d)
+	}
+	heap.Push(h, &fuzzyItem{branch: b, key: key, pending: pending, st: st, dist: dist, count: b.MaxCount})
+}
+
+/*
+pushTaken pushes the Branch `b` that is reached with `key` and all entries of
+which have the distance `dist` - if it is within the maximum distance.
+*/
+func (fs *fuzzySearch) pushTaken(h *fuzzyHeap, b *Branch, key []byte, dist int) {
+	if dist <= fs.maxDist {
+		heap.Push(h, &fuzzyItem{branch: b, key: key, dist: dist, count: b.MaxCount})
+	}
+}
+
+/*
+fuzzyItem is either a complete entry (branch is nil) with its count and
+distance or a Branch that still needs to be expanded with its MaxCount as count
+and the lowest distance any entry below it can have. The key of a Branch item
+does not include its LeafValue. `st` is the state of the search at the Branch
+with the last `pending` bytes of the key not forming a complete rune yet - or
+nil if all entries below have the distance of the item.
+*/
+type fuzzyItem struct {
+	branch  *Branch
+	key     []byte
+	pending int
+	st      *fuzzyPrefixState
+	dist    int
+	count   int64
+}
+
+/*
+fuzzyHeap is a min heap of fuzzyItems ordered by distance, then by count
+(highest first) and then by key - like topKHeap. No entry below a Branch comes
+before the Branch, so the entries are taken off the heap in the order of
+FuzzyPrefixMembers.
+*/
+type fuzzyHeap []*fuzzyItem
+
+func (h fuzzyHeap) Len() int {
+	return len(h)
+}
+
+func (h fuzzyHeap) Less(i, j int) bool {
+	if h[i].dist != h[j].dist {
+		return h[i].dist < h[j].dist
+	}
+	if h[i].count != h[j].count {
+		return h[i].count > h[j].count
+	}
+	if c := bytes.Compare(h[i].key, h[j].key); c != 0 {
+		return c < 0
+	}
+	return h[i].branch == nil && h[j].branch != nil
+}
+
+func (h fuzzyHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+
+func (h *fuzzyHeap) Push(x interface{}) {
+	*h = append(*h, x.(*fuzzyItem))
+}
+
+func (h *fuzzyHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+/*
+step returns the row of edit distances after appending the symbol `sym` - or
+nil if no entry below can be within the maximum distance anymore.
+*/
+func (fs *fuzzySearch) step(row []int, sym rune) []int {
+	next := nextRow(fs.query, sym, row)
+	for _, d := range next {
+		if d <= fs.maxDist {
+			return next
+		}
+	}
+	return nil
+}
+
+/*
+nextRow calculates the row of Levenshtein distances of all prefixes of `query`
+after appending `sym` to the string `row` was calculated for.
+*/
+func nextRow(query []rune, sym rune, row []int) []int {
+	next := make([]int, len(row))
+	next[0] = row[0] + 1
+	for j := 1; j < len(row); j++ {
+		cost := 1
+		if query[j-1] == sym {
+			cost = 0
+		}
+		next[j] = minInt(minInt(row[j]+1, next[j-1]+1), row[j-1]+cost)
+	}
+	return next
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,240 @@
+package trie
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func levenshtein(a, b []rune) int {
+	row := make([]int, len(b)+1)
+	for i := range row {
+		row[i] = i
+	}
+	for _, r := range a {
+		row = nextRow(b, r, row)
+	}
+	return row[len(b)]
+}
+
+func TestTrieFuzzyMembers(t *testing.T) {
+	tr := NewTrie()
+	tr.Add("test")
+	tr.Add("test")
+	tr.Add("tests")
+	tr.Add("text")
+	tr.Add("tea")
+	tr.Add("toast")
+	tr.Add("foo")
+
+	matches := tr.FuzzyMembers("test", 1)
+	expected := []*FuzzyMatch{{"test", 2, 0}, {"tests", 1, 1}, {"text", 1, 1}}
+	if len(matches) != len(expected) {
+		t.Fatalf("Expected FuzzyMembers('test', 1) to be %v, got %v instead.", expected, matches)
+	}
+	for i, fm := range expected {
+		if *matches[i] != *fm {
+			t.Errorf("Expected match %v to be %v, got %v instead.", i, fm, matches[i])
+		}
+	}
+
+	if matches = tr.FuzzyMembers("test", 0); len(matches) != 1 || matches[0].Value != "test" {
+		t.Errorf("Expected FuzzyMembers('test', 0) to only find test, got %v instead.", matches)
+	}
+	if matches = tr.FuzzyMembers("test", -1); len(matches) != 0 {
+		t.Errorf("Expected FuzzyMembers('test', -1) to find nothing, got %v instead.", matches)
+	}
+	if matches = tr.FuzzyMembers("", 3); len(matches) != 2 {
+		t.Errorf("Expected FuzzyMembers('', 3) to find foo and tea, got %v instead.", matches)
+	}
+}
+
+func TestTrieFuzzyMembersRandom(t *testing.T) {
+	tr := NewTrie()
+	var words []string
+	for n := 0; n < 500; n++ {
+		str := []byte{}
+		for i := 0; i < 1+rand.Intn(6); i++ {
+			str = append(str, byte('a'+rand.Intn(5)))
+		}
+		words = append(words, string(str))
+		tr.Add(string(str))
+	}
+
+	query := "abcd"
+	found := make(map[string]int)
+	for _, fm := range tr.FuzzyMembers(query, 2) {
+		found[fm.Value] = fm.Distance
+	}
+	for _, w := range words {
+		d := levenshtein([]rune(w), []rune(query))
+		fd, ok := found[w]
+		if d <= 2 && (!ok || fd != d) {
+			t.Errorf("Expected %s to be found with distance %v, got %v %v instead.", w, d, fd, ok)
+		}
+		if d > 2 && ok {
+			t.Errorf("Expected %s (distance %v) not to be found.", w, d)
+		}
+	}
+}
+
+func TestTrieFuzzyMembersRunes(t *testing.T) {
+	tr := NewTrie()
+	tr.Add("日本人")
+	tr.Add("日本")
+	tr.Add("日本語学校")
+	tr.Add("学校")
+	tr.Add("日本語")
+
+	matches := tr.FuzzyMembersRunes("日本", 1)
+	expected := []*FuzzyMatch{{"日本", 1, 0}, {"日本人", 1, 1}, {"日本語", 1, 1}}
+	if len(matches) != len(expected) {
+		t.Fatalf("Expected FuzzyMembersRunes('日本', 1) to be %v, got %v instead.", expected, matches)
+	}
+	for i, fm := range expected {
+		if *matches[i] != *fm {
+			t.Errorf("Expected match %v to be %v, got %v instead.", i, fm, matches[i])
+		}
+	}
+
+	// 月 and 日 only share their first byte
+	if matches = tr.FuzzyMembersRunes("月本", 1); len(matches) != 1 || matches[0].Value != "日本" {
+		t.Errorf("Expected FuzzyMembersRunes('月本', 1) to find 日本, got %v instead.", matches)
+	}
+
+	// byte based the same entries are much further apart
+	if matches = tr.FuzzyMembers("日本", 1); len(matches) != 1 {
+		t.Errorf("Expected FuzzyMembers('日本', 1) to only find 日本, got %v instead.", matches)
+	}
+	if matches = tr.FuzzyMembers("日本", 3); len(matches) != 3 {
+		t.Errorf("Expected FuzzyMembers('日本', 3) to find 3 entries, got %v instead.", matches)
+	}
+}
+
+func TestTrieFuzzyPrefixMembers(t *testing.T) {
+	tr := NewTrie()
+	tr.Add("testing")
+	tr.Add("testing")
+	tr.Add("tests")
+	tr.Add("tea")
+	tr.Add("toast")
+	tr.Add("foo")
+
+	matches := tr.FuzzyPrefixMembers("tset", 2, 0)
+	expected := []*FuzzyMatch{{"testing", 2, 2}, {"tea", 1, 2}, {"tests", 1, 2}}
+	if len(matches) != len(expected) {
+		t.Fatalf("Expected FuzzyPrefixMembers('tset', 2, 0) to be %v, got %v instead.", expected, matches)
+	}
+	for i, fm := range expected {
+		if *matches[i] != *fm {
+			t.Errorf("Expected match %v to be %v, got %v instead.", i, fm, matches[i])
+		}
+	}
+
+	matches = tr.FuzzyPrefixMembers("tesy", 1, 2)
+	expected = []*FuzzyMatch{{"testing", 2, 1}, {"tests", 1, 1}}
+	if len(matches) != len(expected) {
+		t.Fatalf("Expected FuzzyPrefixMembers('tesy', 1, 2) to be %v, got %v instead.", expected, matches)
+	}
+	for i, fm := range expected {
+		if *matches[i] != *fm {
+			t.Errorf("Expected match %v to be %v, got %v instead.", i, fm, matches[i])
+		}
+	}
+
+	if matches = tr.FuzzyPrefixMembers("", 0, 0); len(matches) != 5 {
+		t.Errorf("Expected FuzzyPrefixMembers('', 0, 0) to find all 5 entries, got %v instead.", matches)
+	}
+	if matches = tr.FuzzyPrefixMembers("xyz", 1, 0); len(matches) != 0 {
+		t.Errorf("Expected FuzzyPrefixMembers('xyz', 1, 0) to find nothing, got %v instead.", matches)
+	}
+}
+
+func TestTrieFuzzyPrefixMembersRandom(t *testing.T) {
+	tr := NewTrie()
+	var words []string
+	for n := 0; n < 500; n++ {
+		str := []byte{}
+		for i := 0; i < 1+rand.Intn(8); i++ {
+			str = append(str, byte('a'+rand.Intn(5)))
+		}
+		words = append(words, string(str))
+		tr.Add(string(str))
+	}
+
+	query := []rune("abcd")
+	found := make(map[string]int)
+	for _, fm := range tr.FuzzyPrefixMembers(string(query), 1, 0) {
+		found[fm.Value] = fm.Distance
+	}
+	for _, w := range words {
+		d := len(query)
+		for i := 0; i <= len(w); i++ {
+			d = minInt(d, levenshtein([]rune(w[:i]), query))
+		}
+		fd, ok := found[w]
+		if d <= 1 && (!ok || fd != d) {
+			t.Errorf("Expected %s to be found with distance %v, got %v %v instead.", w, d, fd, ok)
+		}
+		if d > 1 && ok {
+			t.Errorf("Expected %s (distance %v) not to be found.", w, d)
+		}
+	}
+}
+
+func TestTrieFuzzyPrefixMembersRunes(t *testing.T) {
+	tr := NewTrie()
+	tr.Add("日本人")
+	tr.Add("日本語学校")
+	tr.Add("学校")
+
+	matches := tr.FuzzyPrefixMembersRunes("月本語", 1, 0)
+	if len(matches) != 1 || matches[0].Value != "日本語学校" || matches[0].Distance != 1 {
+		t.Errorf("Expected FuzzyPrefixMembersRunes('月本語', 1, 0) to find 日本語学校, got %v instead.", matches)
+	}
+	if matches = tr.FuzzyPrefixMembers("月本語", 1, 0); len(matches) != 0 {
+		t.Errorf("Expected FuzzyPrefixMembers('月本語', 1, 0) to find nothing, got %v instead.", matches)
+	}
+}
+
+func TestTrieFuzzyPrefixMembersLimit(t *testing.T) {
+	tr := NewTrie()
+	for n := 0; n < 2000; n++ {
+		str := []byte("te")
+		for i := 0; i < 1+rand.Intn(8); i++ {
+			str = append(str, byte('a'+rand.Intn(5)))
+		}
+		tr.AddWithCount(string(str), int64(1+rand.Intn(20)))
+	}
+	tr.AddWithCount("tsaa", 3)
+
+	for _, query := range []string{"te", "tea", "tsa", "tac"} {
+		all := tr.FuzzyPrefixMembers(query, 1, 0)
+		for i := 1; i < len(all); i++ {
+			a, b := all[i-1], all[i]
+			if a.Distance > b.Distance || (a.Distance == b.Distance && (a.Count < b.Count || (a.Count == b.Count && a.Value >= b.Value))) {
+				t.Errorf("Expected FuzzyPrefixMembers('%s', 1, 0) to be ordered, got %v before %v.", query, a, b)
+			}
+		}
+		for _, limit := range []int{1, 5, 50} {
+			matches := tr.FuzzyPrefixMembers(query, 1, limit)
+			if len(matches) != minInt(limit, len(all)) {
+				t.Errorf("Expected FuzzyPrefixMembers('%s', 1, %v) to find %v entries, got %v instead.", query, limit, minInt(limit, len(all)), len(matches))
+				continue
+			}
+			for i, fm := range matches {
+				if *fm != *all[i] {
+					t.Errorf("Expected match %v of FuzzyPrefixMembers('%s', 1, %v) to be %v, got %v instead.", i, query, limit, all[i], fm)
+				}
+			}
+		}
+	}
+
+	// the limit bounds the number of visited Branches - not only the result
+	full := newFuzzySearch("te", 1, false)
+	full.searchPrefix(tr.Root, 0)
+	limited := newFuzzySearch("te", 1, false)
+	limited.searchPrefix(tr.Root, 5)
+	if len(limited.matches) != 5 || limited.visited*10 > full.visited {
+		t.Errorf("Expected a search for 5 matches to visit far less than the %v items of the full search, got %v instead.", full.visited, limited.visited)
+	}
+}
@@ -0,0 +1,3 @@
+module github.com/fvbock/trie
+
+go 1.19
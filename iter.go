@@ -0,0 +1,212 @@
+package trie
+
+import (
+	"bytes"
+	"sort"
+)
+
+/*
+Iterator streams the entries of a Trie (or of the part of it below a prefix)
+in lexicographic (byte) order without materializing them all up front.
+
+	it := t.Iter("foo")
+	defer it.Close()
+	for it.Next() {
+		fmt.Println(it.Value(), it.Count())
+	}
+
+Every call to Next read locks the Trie only while it looks for the next entry,
+so the Trie can be changed between two calls - also from the loop itself. The
+Iterator then continues with the first entry after the current one in the
+changed Trie: entries added behind the current one are returned, entries
+removed before they were reached are not.
+*/
+type Iterator struct {
+	trie    *Trie
+	prefix  []byte
+	version uint64
+	key     []byte
+	stack   []iterFrame
+	pending *Branch
+	value   string
+	count   int64
+	started bool
+	done    bool
+}
+
+/*
+iterFrame holds the traversal state of a single Branch: its branch indexes in
+iteration order, the position of the next one to descend into and the length
+of the key up to and including the LeafValue of the Branch.
+*/
+type iterFrame struct {
+	branch *Branch
+	idxs   []byte
+	pos    int
+	keyLen int
+}
+
+/*
+Iter returns an Iterator over all entries of the Trie that have the given
+prefix. An empty prefix iterates over all entries.
+*/
+func (t *Trie) Iter(prefix string) *Iterator {
+	return &Iterator{trie: t, prefix: []byte(prefix)}
+}
+
+/*
+Next advances the Iterator to the next entry. It returns false when there are
+no more entries.
+*/
+func (it *Iterator) Next() bool {
+	if it.done {
+		return false
+	}
+	it.trie.Root.RLock()
+	defer it.trie.Root.RUnlock()
+	if !it.started || it.version != it.trie.version {
+		it.seek()
+	}
+
+	if b := it.pending; b != nil {
+		it.pending = nil
+		if it.push(b) {
+			return true
+		}
+	}
+	for len(it.stack) > 0 {
+		top := &it.stack[len(it.stack)-1]
+		if top.pos >= len(top.idxs) {
+			it.stack = it.stack[:len(it.stack)-1]
+			continue
+		}
+		idx := top.idxs[top.pos]
+		top.pos++
+		it.key = append(it.key[:top.keyLen], idx)
+		if it.push(top.branch.Branches[idx]) {
+			return true
+		}
+	}
+	it.Close()
+	return false
+}
+
+/*
+Close stops the Iterator, Next returns false afterwards. It is called by Next
+once there are no more entries, calling it more than once is fine.
+*/
+func (it *Iterator) Close() {
+	it.done = true
+	it.stack, it.pending = nil, nil
+	it.value, it.count = "", 0
+}
+
+/*
+Value returns the entry the Iterator currently points at.
+*/
+func (it *Iterator) Value() string {
+	return it.value
+}
+
+/*
+Count returns the count of the entry the Iterator currently points at.
+*/
+func (it *Iterator) Count() int64 {
+	return it.count
+}
+
+/*
+push appends the LeafValue of `b` to the current key and puts `b` on the
+stack. It returns true if `b` marks the end of an entry, in which case that
+entry becomes the current value of the Iterator.
+*/
+func (it *Iterator) push(b *Branch) bool {
+	it.key = append(it.key, b.LeafValue...)
+	it.stack = append(it.stack, iterFrame{
+		branch: b,
+		idxs:   b.sortedIdxs(false),
+		keyLen: len(it.key),
+	})
+	if b.End {
+		it.value, it.count = string(it.key), b.Count
+		return true
+	}
+	return false
+}
+
+/*
+seek rebuilds the traversal state from the current content of the Trie, which
+has to be read locked. A new Iterator starts at the first entry with the
+prefix, a started one continues after its current entry.
+*/
+func (it *Iterator) seek() {
+	it.version = it.trie.version
+	it.stack, it.pending = it.stack[:0], nil
+	exists, b, key := it.trie.Root.hasPrefixBranch(it.prefix)
+	if !exists {
+		return
+	}
+	if !it.started {
+		it.started = true
+		it.key, it.pending = key, b
+		return
+	}
+
+	after := []byte(it.value)
+	defer func() { it.key = key }()
+	for {
+		path := append(key, b.LeafValue...)
+		if !bytes.HasPrefix(after, path) {
+			// all entries of b come either before or after the current one
+			if bytes.Compare(path, after) > 0 {
+				it.pending = b
+			}
+			return
+		}
+		key = path
+		frame := iterFrame{branch: b, idxs: b.sortedIdxs(false), keyLen: len(key)}
+		if len(key) == len(after) {
+			it.stack = append(it.stack, frame)
+			return
+		}
+		idx := after[len(key)]
+		frame.pos = sort.Search(len(frame.idxs), func(i int) bool { return frame.idxs[i] > idx })
+		it.stack = append(it.stack, frame)
+		next, present := b.Branches[idx]
+		if !present {
+			return
+		}
+		key, b = append(key, idx), next
+	}
+}
+
+/*
+Walk calls `fn` for every entry of the Trie that has the given prefix in
+lexicographic (byte) order. The walk stops as soon as `fn` returns false. The
+Trie is read locked during the walk, so `fn` must not modify it.
+*/
+func (t *Trie) Walk(prefix string, fn func(key string, count int64) bool) {
+	t.Root.RLock()
+	defer t.Root.RUnlock()
+	exists, br, matchedPrefix := t.Root.hasPrefixBranch([]byte(prefix))
+	if exists {
+		br.walk(matchedPrefix, fn)
+	}
+}
+
+/*
+walk calls `fn` for every entry of the Branch prepended with `branchPrefix`.
+It returns false if `fn` asked to stop.
+*/
+func (b *Branch) walk(branchPrefix []byte, fn func(key string, count int64) bool) bool {
+	key := append(branchPrefix, b.LeafValue...)
+	if b.End && !fn(string(key), b.Count) {
+		return false
+	}
+	for _, idx := range b.sortedIdxs(false) {
+		if !b.Branches[idx].walk(append(key, idx), fn) {
+			return false
+		}
+	}
+	return true
+}
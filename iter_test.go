@@ -0,0 +1,202 @@
+package trie
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestTrieIter(t *testing.T) {
+	tr := NewTrie()
+	tr.Add("teased")
+	tr.Add("test")
+	tr.Add("test")
+	tr.Add("testing")
+	tr.Add("tea")
+	tr.Add("foo")
+
+	expected := tr.PrefixMembers("te")
+	it := tr.Iter("te")
+	i := 0
+	for it.Next() {
+		if i >= len(expected) {
+			t.Fatalf("Iter('te') returned more than %v entries", len(expected))
+		}
+		if it.Value() != expected[i].Value || it.Count() != expected[i].Count {
+			t.Errorf("Expected entry %v to be %v, got %s(%v) instead.", i, expected[i], it.Value(), it.Count())
+		}
+		i++
+	}
+	if i != len(expected) {
+		t.Errorf("Expected Iter('te') to return %v entries, got %v instead.", len(expected), i)
+	}
+	if it.Next() {
+		t.Error("Expected Next() to keep returning false after the last entry")
+	}
+
+	i = 0
+	for it = tr.Iter(""); it.Next(); i++ {
+	}
+	if i != 5 {
+		t.Errorf("Expected Iter('') to return 5 entries, got %v instead.", i)
+	}
+
+	if tr.Iter("x").Next() {
+		t.Error("Expected Iter('x') to return no entries")
+	}
+	if NewTrie().Iter("").Next() {
+		t.Error("Expected Iter('') on an empty Trie to return no entries")
+	}
+}
+
+func TestTrieIterMultibyte(t *testing.T) {
+	tr := NewTrie()
+	tr.Add("フードスポンサー")
+	tr.Add("フードラボ")
+	tr.Add("日本語")
+
+	var members []string
+	for it := tr.Iter("フー"); it.Next(); {
+		members = append(members, it.Value())
+	}
+	if len(members) != 2 || members[0] != "フードスポンサー" || members[1] != "フードラボ" {
+		t.Errorf("Unexpected Iter('フー') result: %v", members)
+	}
+}
+
+func TestTrieIterModify(t *testing.T) {
+	tr := NewTrie()
+	for _, w := range []string{"tea", "teased", "test", "testing", "toast"} {
+		tr.Add(w)
+	}
+
+	var members []string
+	for it := tr.Iter("te"); it.Next(); {
+		members = append(members, it.Value())
+		switch it.Value() {
+		case "tea":
+			tr.Delete("tea")
+			tr.Delete("teased")
+			tr.Add("tease")
+			tr.Add("ta")
+			tr.Add("tested")
+		case "test":
+			tr.Delete("testing")
+		}
+	}
+	if len(members) != 4 || members[0] != "tea" || members[1] != "tease" || members[2] != "test" || members[3] != "tested" {
+		t.Errorf("Unexpected entries while modifying the Trie: %v", members)
+	}
+
+	for round := 0; round < 20; round++ {
+		tr := NewTrie()
+		for n := 0; n < 300; n++ {
+			str := []byte{}
+			for i := 0; i < 1+rand.Intn(6); i++ {
+				str = append(str, byte('a'+rand.Intn(3)))
+			}
+			tr.Add(string(str))
+		}
+		// entries that are never deleted have to be returned exactly once
+		kept := make(map[string]bool)
+		for _, mi := range tr.Members() {
+			kept[mi.Value] = true
+		}
+
+		last := ""
+		for it := tr.Iter(""); it.Next(); {
+			if it.Value() <= last && last != "" {
+				t.Fatalf("Expected entries in lexicographic order, got %s after %s", it.Value(), last)
+			}
+			if !tr.Has(it.Value()) {
+				t.Fatalf("Iterator returned %s which does not exist", it.Value())
+			}
+			last = it.Value()
+			delete(kept, last)
+			for i := 0; i < 3; i++ {
+				str := []byte{}
+				for i := 0; i < 1+rand.Intn(6); i++ {
+					str = append(str, byte('a'+rand.Intn(3)))
+				}
+				if rand.Intn(2) == 0 {
+					for tr.Has(string(str)) {
+						tr.Delete(string(str))
+					}
+					delete(kept, string(str))
+				} else {
+					tr.Add(string(str))
+				}
+			}
+		}
+		if len(kept) != 0 {
+			t.Errorf("Expected the Iterator to return all kept entries, missing %v", kept)
+		}
+	}
+}
+
+func TestTrieWalk(t *testing.T) {
+	tr := NewTrie()
+	tr.Add("tease")
+	tr.Add("teases")
+	tr.Add("teased")
+	tr.Add("test")
+	tr.Add("test")
+	tr.Add("testing")
+
+	var keys []string
+	var counts []int64
+	tr.Walk("", func(key string, count int64) bool {
+		keys = append(keys, key)
+		counts = append(counts, count)
+		return true
+	})
+	expected := tr.Members()
+	if len(keys) != len(expected) {
+		t.Fatalf("Expected Walk to visit %v entries, got %v instead.", len(expected), len(keys))
+	}
+	for i, mi := range expected {
+		if keys[i] != mi.Value || counts[i] != mi.Count {
+			t.Errorf("Expected entry %v to be %v, got %s(%v) instead.", i, mi, keys[i], counts[i])
+		}
+	}
+
+	// early stop
+	keys = []string{}
+	tr.Walk("tease", func(key string, count int64) bool {
+		keys = append(keys, key)
+		return len(keys) < 2
+	})
+	if len(keys) != 2 || keys[0] != "tease" || keys[1] != "teased" {
+		t.Errorf("Expected Walk to stop after tease and teased, got %v instead.", keys)
+	}
+
+	called := false
+	tr.Walk("x", func(key string, count int64) bool {
+		called = true
+		return true
+	})
+	if called {
+		t.Error("Expected Walk('x') not to call fn")
+	}
+}
+
+func TestTrieIterClose(t *testing.T) {
+	tr := NewTrie()
+	tr.Add("foo")
+	tr.Add("foobar")
+
+	it := tr.Iter("foo")
+	if !it.Next() || it.Value() != "foo" {
+		t.Fatalf("Expected the first entry to be foo, got %s instead.", it.Value())
+	}
+	it.Close()
+	it.Close()
+	if it.Next() {
+		t.Error("Expected Next() to return false after Close()")
+	}
+
+	// the read lock has to be released so writers do not block
+	tr.Add("foobaz")
+	if !tr.Has("foobaz") {
+		t.Error("Expected foobaz")
+	}
+}
@@ -0,0 +1,364 @@
+package trie
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+/*
+The mapped format written by WriteMapped is a flat layout of the Branches that
+can be searched in place, so a MappedTrie does not need to decode it:
+
+	magic     4 bytes  "TRMM"
+	version   1 byte
+	reserved  3 bytes
+	nodes     one per Branch, children before their parents
+	root      8 bytes  offset of the root node
+
+Every node is laid out as
+
+	count     8 bytes  count of the entry ending here, 0 if there is none
+	sum       8 bytes  sum of the counts of all entries below the node
+	leaf len  4 bytes
+	branches  2 bytes  number of branches
+	flags     1 byte   bit 0: End
+	reserved  1 byte
+	indexes   1 byte per branch in ascending order
+	offsets   8 bytes per branch - offset of the branch node
+	leaf      bytes
+
+All numbers are little endian. Payloads are not written.
+*/
+const (
+	mappedMagic   = "TRMM"
+	mappedVersion = 1
+
+	mappedHeaderLen  = 8
+	mappedTrailerLen = 8
+	mappedNodeLen    = 24
+)
+
+var (
+	ErrBadMapped = errors.New("Not a mapped Trie file")
+)
+
+/*
+WriteMapped writes the Trie in the mapped format to `w` - see OpenMappedTrie.
+It returns the number of bytes written.
+*/
+func (t *Trie) WriteMapped(w io.Writer) (n int64, err error) {
+	t.Root.RLock()
+	defer t.Root.RUnlock()
+
+	mw := &mappedWriter{w: bufio.NewWriter(w)}
+	mw.write(append([]byte(mappedMagic), mappedVersion, 0, 0, 0))
+	root, _ := mw.branch(t.Root)
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], root)
+	mw.write(buf[:])
+	if mw.err == nil {
+		mw.err = mw.w.Flush()
+	}
+	return int64(mw.off), mw.err
+}
+
+/*
+DumpToMappedFile writes the Trie in the mapped format to a file. Like
+DumpToFile it replaces an existing file atomically.
+*/
+func (t *Trie) DumpToMappedFile(fname string) error {
+	return writeFileAtomic(fname, func(w io.Writer) error {
+		_, err := t.WriteMapped(w)
+		return err
+	})
+}
+
+type mappedWriter struct {
+	w   *bufio.Writer
+	off uint64
+	err error
+}
+
+func (mw *mappedWriter) write(p []byte) {
+	if mw.err != nil {
+		return
+	}
+	var n int
+	n, mw.err = mw.w.Write(p)
+	mw.off += uint64(n)
+}
+
+/*
+branch writes the nodes of `b` and all its branches and returns the offset of
+the node of `b` and the sum of the counts below it.
+*/
+func (mw *mappedWriter) branch(b *Branch) (offset uint64, sum int64) {
+	idxs := b.sortedIdxs(false)
+	offsets := make([]uint64, len(idxs))
+	for i, idx := range idxs {
+		var s int64
+		offsets[i], s = mw.branch(b.Branches[idx])
+		sum += s
+	}
+
+	node := make([]byte, mappedNodeLen, mappedNodeLen+9*len(idxs)+len(b.LeafValue))
+	if b.End {
+		sum += b.Count
+		binary.LittleEndian.PutUint64(node[0:], uint64(b.Count))
+		node[22] = 1
+	}
+	binary.LittleEndian.PutUint64(node[8:], uint64(sum))
+	binary.LittleEndian.PutUint32(node[16:], uint32(len(b.LeafValue)))
+	binary.LittleEndian.PutUint16(node[20:], uint16(len(idxs)))
+	node = append(node, idxs...)
+	for _, o := range offsets {
+		node = binary.LittleEndian.AppendUint64(node, o)
+	}
+	node = append(node, b.LeafValue...)
+
+	offset = mw.off
+	mw.write(node)
+	return
+}
+
+/*
+MappedTrie is a read-only Trie that is searched directly in the bytes of a
+file in the mapped format, which are memory mapped where the platform supports
+it. Opening it does not depend on the size of the file and several processes
+mapping the same file share its pages.
+
+A MappedTrie is safe for concurrent use. It must not be used after Close.
+*/
+type MappedTrie struct {
+	data  []byte
+	root  uint64
+	close func() error
+}
+
+/*
+OpenMappedTrie opens a file written by DumpToMappedFile.
+*/
+func OpenMappedTrie(fname string) (mt *MappedTrie, err error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		err = errors.New(fmt.Sprintf("Could not open mapped Trie file: %v", err))
+		return
+	}
+	defer f.Close()
+
+	data, unmap, err := mapFile(f)
+	if err != nil {
+		err = errors.New(fmt.Sprintf("Could not map Trie file: %v", err))
+		return
+	}
+	if mt, err = NewMappedTrie(data); err != nil {
+		unmap()
+		return nil, err
+	}
+	mt.close = unmap
+	return
+}
+
+/*
+NewMappedTrie returns a MappedTrie reading from `data`, which has to be in the
+mapped format and must not be modified while the MappedTrie is in use.
+*/
+func NewMappedTrie(data []byte) (*MappedTrie, error) {
+	if len(data) < mappedHeaderLen+mappedTrailerLen+mappedNodeLen || string(data[:len(mappedMagic)]) != mappedMagic {
+		return nil, ErrBadMapped
+	}
+	if data[len(mappedMagic)] != mappedVersion {
+		return nil, ErrUnsupportedVersion
+	}
+	root := binary.LittleEndian.Uint64(data[len(data)-mappedTrailerLen:])
+	mt := &MappedTrie{
+		data: data[:len(data)-mappedTrailerLen],
+		root: root,
+	}
+	if _, ok := mt.node(root); !ok {
+		return nil, ErrBadMapped
+	}
+	return mt, nil
+}
+
+/*
+Close releases the mapped file.
+*/
+func (mt *MappedTrie) Close() (err error) {
+	if mt.close != nil {
+		err = mt.close()
+		mt.close = nil
+	}
+	mt.data = nil
+	return
+}
+
+/*
+Has returns true if the `entry` exists in the `MappedTrie`
+*/
+func (mt *MappedTrie) Has(entry string) bool {
+	exists, _ := mt.HasCount(entry)
+	return exists
+}
+
+/*
+HasCount returns true if the `entry` exists in the `MappedTrie`. The second
+returned value is the count how often the entry has been set.
+*/
+func (mt *MappedTrie) HasCount(entry string) (exists bool, count int64) {
+	n, rest, ok := mt.find(entry)
+	if !ok || len(rest) > 0 || !n.end() {
+		return false, 0
+	}
+	return true, n.count()
+}
+
+/*
+HasPrefix returns true if the the `MappedTrie` contains entries with the given
+prefix
+*/
+func (mt *MappedTrie) HasPrefix(prefix string) bool {
+	_, _, ok := mt.find(prefix)
+	return ok
+}
+
+/*
+HasPrefixCount returns true if the the `MappedTrie` contains entries with the
+given prefix. The second returned value is the sum of the counts of these
+entries.
+*/
+func (mt *MappedTrie) HasPrefixCount(prefix string) (exists bool, count int64) {
+	n, _, ok := mt.find(prefix)
+	if !ok {
+		return false, 0
+	}
+	return true, n.sum()
+}
+
+/*
+PrefixMembers returns all entries of the MappedTrie that have the given prefix
+with their counts as MemberInfo in lexicographic (byte) order
+*/
+func (mt *MappedTrie) PrefixMembers(prefix string) (members []*MemberInfo) {
+	n, rest, ok := mt.find(prefix)
+	if !ok {
+		return
+	}
+	key := append([]byte(prefix), rest...)
+	return mt.members(n, key, members)
+}
+
+func (mt *MappedTrie) members(n mappedNode, key []byte, members []*MemberInfo) []*MemberInfo {
+	if n.end() {
+		members = append(members, &MemberInfo{string(key), n.count()})
+	}
+	for i, idx := range n.idxs() {
+		if child, ok := mt.child(n, i); ok {
+			members = mt.members(child, append(append(key, idx), child.leaf()...), members)
+		}
+	}
+	return members
+}
+
+/*
+find descends to the node whose path contains `prefix`. `rest` is the part of
+the node's LeafValue that follows the prefix.
+*/
+func (mt *MappedTrie) find(prefix string) (n mappedNode, rest []byte, ok bool) {
+	if n, ok = mt.node(mt.root); !ok {
+		return
+	}
+	for {
+		leaf := n.leaf()
+		if len(prefix) <= len(leaf) {
+			if string(leaf[:len(prefix)]) != prefix {
+				return n, nil, false
+			}
+			return n, leaf[len(prefix):], true
+		}
+		if string(leaf) != prefix[:len(leaf)] {
+			return n, nil, false
+		}
+		idxs := n.idxs()
+		c := prefix[len(leaf)]
+		i := sort.Search(len(idxs), func(i int) bool { return idxs[i] >= c })
+		if i == len(idxs) || idxs[i] != c {
+			return n, nil, false
+		}
+		if n, ok = mt.child(n, i); !ok {
+			return
+		}
+		prefix = prefix[len(leaf)+1:]
+	}
+}
+
+/*
+mappedNode is a node in the mapped format. It holds the offset of the node and
+its bytes up to the end of its LeafValue.
+*/
+type mappedNode struct {
+	off uint64
+	b   []byte
+}
+
+/*
+node returns the node at `offset`. `ok` is false if it does not fit into the
+data.
+*/
+func (mt *MappedTrie) node(offset uint64) (n mappedNode, ok bool) {
+	if offset < mappedHeaderLen || offset+mappedNodeLen > uint64(len(mt.data)) {
+		return mappedNode{}, false
+	}
+	head := mt.data[offset : offset+mappedNodeLen]
+	size := uint64(mappedNodeLen) + 9*uint64(binary.LittleEndian.Uint16(head[20:])) + uint64(binary.LittleEndian.Uint32(head[16:]))
+	if offset+size > uint64(len(mt.data)) {
+		return mappedNode{}, false
+	}
+	return mappedNode{offset, mt.data[offset : offset+size]}, true
+}
+
+/*
+child returns the `i`th branch of `n`. Branches are written before their
+parents, so a branch with a higher offset than its parent is not accepted -
+this keeps a damaged file from sending us in circles.
+*/
+func (mt *MappedTrie) child(n mappedNode, i int) (mappedNode, bool) {
+	offset := n.offset(i)
+	if offset >= n.off {
+		return mappedNode{}, false
+	}
+	return mt.node(offset)
+}
+
+func (n mappedNode) count() int64 {
+	return int64(binary.LittleEndian.Uint64(n.b[0:]))
+}
+
+func (n mappedNode) sum() int64 {
+	return int64(binary.LittleEndian.Uint64(n.b[8:]))
+}
+
+func (n mappedNode) end() bool {
+	return n.b[22]&1 != 0
+}
+
+func (n mappedNode) numBranches() int {
+	return int(binary.LittleEndian.Uint16(n.b[20:]))
+}
+
+func (n mappedNode) idxs() []byte {
+	return n.b[mappedNodeLen : mappedNodeLen+n.numBranches()]
+}
+
+func (n mappedNode) offset(i int) uint64 {
+	return binary.LittleEndian.Uint64(n.b[mappedNodeLen+n.numBranches()+8*i:])
+}
+
+func (n mappedNode) leaf() []byte {
+	return n.b[mappedNodeLen+9*n.numBranches():]
+}
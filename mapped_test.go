@@ -0,0 +1,90 @@
+package trie
+
+import (
+	"bytes"
+	"math/rand"
+	"path/filepath"
+	"testing"
+)
+
+func TestMappedTrie(t *testing.T) {
+	tr := NewTrie()
+	for _, w := range []string{"test", "test", "testing", "tea", "te", "foodchain", "food", "日本", "日本語学校"} {
+		tr.Add(w)
+	}
+	for n := 0; n < 1000; n++ {
+		str := []byte{}
+		for i := 0; i < 1+rand.Intn(6); i++ {
+			str = append(str, byte('a'+rand.Intn(4)))
+		}
+		tr.AddWithCount(string(str), int64(1+rand.Intn(10)))
+	}
+
+	fname := filepath.Join(t.TempDir(), "mapped")
+	if err := tr.DumpToMappedFile(fname); err != nil {
+		t.Fatalf("Failed to write mapped Trie: %v", err)
+	}
+	mt, err := OpenMappedTrie(fname)
+	if err != nil {
+		t.Fatalf("Failed to open mapped Trie: %v", err)
+	}
+	defer mt.Close()
+
+	queries := []string{"", "t", "te", "tes", "test", "testi", "testing", "testings", "x", "f", "food", "foodc", "日", "日本", "日本語", string([]byte{0xe6, 0x97})}
+	for n := 0; n < 1000; n++ {
+		str := []byte{}
+		for i := 0; i < rand.Intn(7); i++ {
+			str = append(str, byte('a'+rand.Intn(5)))
+		}
+		queries = append(queries, string(str))
+	}
+	for _, q := range queries {
+		e1, c1 := tr.HasCount(q)
+		if e2, c2 := mt.HasCount(q); e1 != e2 || c1 != c2 || mt.Has(q) != e1 {
+			t.Errorf("HasCount('%s'): expected %v %v, got %v %v instead.", q, e1, c1, e2, c2)
+		}
+		e1, c1 = tr.HasPrefixCount(q)
+		if e2, c2 := mt.HasPrefixCount(q); e1 != e2 || c1 != c2 || mt.HasPrefix(q) != e1 {
+			t.Errorf("HasPrefixCount('%s'): expected %v %v, got %v %v instead.", q, e1, c1, e2, c2)
+		}
+		expected, members := tr.PrefixMembers(q), mt.PrefixMembers(q)
+		if len(expected) != len(members) {
+			t.Errorf("PrefixMembers('%s'): expected %v members, got %v instead.", q, len(expected), len(members))
+			continue
+		}
+		for i, mi := range expected {
+			if members[i].Value != mi.Value || members[i].Count != mi.Count {
+				t.Errorf("PrefixMembers('%s'): expected member %v to be %v, got %v instead.", q, i, mi, members[i])
+			}
+		}
+	}
+}
+
+func TestMappedTrieEmptyAndBroken(t *testing.T) {
+	var buf bytes.Buffer
+	if _, err := NewTrie().WriteMapped(&buf); err != nil {
+		t.Fatalf("Failed to write mapped Trie: %v", err)
+	}
+	mt, err := NewMappedTrie(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Failed to read empty mapped Trie: %v", err)
+	}
+	if mt.Has("") || len(mt.PrefixMembers("")) != 0 {
+		t.Error("Expected an empty mapped Trie")
+	}
+	if _, c := mt.HasPrefixCount(""); c != 0 {
+		t.Errorf("Expected prefix count 0, got %v instead.", c)
+	}
+
+	if _, err = NewMappedTrie([]byte("not a mapped trie at all, really not")); err != ErrBadMapped {
+		t.Errorf("Expected ErrBadMapped, got %v instead.", err)
+	}
+	data := buf.Bytes()
+	data[len(data)-1] = 0xff
+	if _, err = NewMappedTrie(data); err != ErrBadMapped {
+		t.Errorf("Expected ErrBadMapped for a broken root offset, got %v instead.", err)
+	}
+	if _, err = OpenMappedTrie("doesnotexist/doesnotexist"); err == nil {
+		t.Error("Expected OpenMappedTrie to fail for a missing file")
+	}
+}
@@ -0,0 +1,211 @@
+package trie
+
+import (
+	"errors"
+)
+
+/*
+ErrBadPattern is returned by Match for malformed patterns.
+*/
+var ErrBadPattern = errors.New("syntax error in pattern")
+
+/*
+Match returns all entries of the Trie that match the glob `pattern` with their
+counts as MemberInfo in lexicographic (byte) order. The pattern syntax is:
+
+	?       matches any single rune
+	*       matches any sequence of runes (including the empty one)
+	[a-z]   matches a single rune out of a class of runes and ranges
+	[!a-z]  (or [^a-z]) matches a single rune not in the class
+	\c      matches the rune c literally
+
+The Trie is walked along the pattern so only subtrees that can still match are
+visited. ErrBadPattern is returned for malformed patterns.
+*/
+func (t *Trie) Match(pattern string) (members []*MemberInfo, err error) {
+	t.Root.RLock()
+	defer t.Root.RUnlock()
+	tokens, err := parsePattern(pattern)
+	if err != nil {
+		return
+	}
+	m := &matcher{tokens: tokens}
+	m.walker().walk(t.Root, []byte{}, 0, m.start())
+	return m.members, nil
+}
+
+type tokenKind int
+
+const (
+	tokenLiteral tokenKind = iota
+	tokenAny
+	tokenStar
+	tokenClass
+)
+
+/*
+patternToken is a single element of a parsed glob pattern. For classes `ranges`
+holds pairs of the lowest and the highest rune of each range.
+*/
+type patternToken struct {
+	kind    tokenKind
+	r       rune
+	ranges  []rune
+	negated bool
+}
+
+func (pt *patternToken) matches(r rune) bool {
+	switch pt.kind {
+	case tokenLiteral:
+		return pt.r == r
+	case tokenAny:
+		return true
+	case tokenClass:
+		for i := 0; i < len(pt.ranges); i += 2 {
+			if pt.ranges[i] <= r && r <= pt.ranges[i+1] {
+				return !pt.negated
+			}
+		}
+		return pt.negated
+	}
+	return false
+}
+
+func parsePattern(pattern string) (tokens []*patternToken, err error) {
+	p := []rune(pattern)
+	for i := 0; i < len(p); i++ {
+		switch p[i] {
+		case '?':
+			tokens = append(tokens, &patternToken{kind: tokenAny})
+		case '*':
+			// consecutive stars are the same as one
+			if len(tokens) == 0 || tokens[len(tokens)-1].kind != tokenStar {
+				tokens = append(tokens, &patternToken{kind: tokenStar})
+			}
+		case '\\':
+			if i++; i == len(p) {
+				return nil, ErrBadPattern
+			}
+			tokens = append(tokens, &patternToken{kind: tokenLiteral, r: p[i]})
+		case '[':
+			pt := &patternToken{kind: tokenClass}
+			i++
+			if i < len(p) && (p[i] == '!' || p[i] == '^') {
+				pt.negated = true
+				i++
+			}
+			for first := true; ; first = false {
+				if i == len(p) {
+					return nil, ErrBadPattern
+				}
+				if p[i] == ']' && !first {
+					break
+				}
+				lo := p[i]
+				if lo == '\\' {
+					if i++; i == len(p) {
+						return nil, ErrBadPattern
+					}
+					lo = p[i]
+				}
+				hi := lo
+				if i+2 < len(p) && p[i+1] == '-' && p[i+2] != ']' {
+					hi = p[i+2]
+					i += 2
+					if hi == '\\' {
+						if i++; i == len(p) {
+							return nil, ErrBadPattern
+						}
+						hi = p[i]
+					}
+					if hi < lo {
+						return nil, ErrBadPattern
+					}
+				}
+				pt.ranges = append(pt.ranges, lo, hi)
+				i++
+			}
+			tokens = append(tokens, pt)
+		default:
+			tokens = append(tokens, &patternToken{kind: tokenLiteral, r: p[i]})
+		}
+	}
+	return
+}
+
+/*
+matcher holds the state of a Match. The positions in `tokens` that the part of
+an entry that was walked so far can reach are tracked as a set of states.
+*/
+type matcher struct {
+	tokens  []*patternToken
+	members []*MemberInfo
+}
+
+/*
+start returns the initial set of states.
+*/
+func (m *matcher) start() []bool {
+	states := make([]bool, len(m.tokens)+1)
+	states[0] = true
+	return m.closure(states)
+}
+
+/*
+closure adds the positions that can be reached by letting a star match the
+empty sequence.
+*/
+func (m *matcher) closure(states []bool) []bool {
+	for pos, pt := range m.tokens {
+		if states[pos] && pt.kind == tokenStar {
+			states[pos+1] = true
+		}
+	}
+	return states
+}
+
+/*
+step advances all states by the rune `r`. It returns nil if no state is left.
+*/
+func (m *matcher) step(states []bool, r rune) []bool {
+	next := make([]bool, len(states))
+	alive := false
+	for pos, pt := range m.tokens {
+		if !states[pos] {
+			continue
+		}
+		if pt.kind == tokenStar {
+			next[pos], alive = true, true
+		} else if pt.matches(r) {
+			next[pos+1], alive = true, true
+		}
+	}
+	if !alive {
+		return nil
+	}
+	return m.closure(next)
+}
+
+func (m *matcher) accepts(states []bool) bool {
+	return states[len(m.tokens)]
+}
+
+/*
+walker returns the runeWalker that runs the matcher along a Trie and collects
+all matching entries.
+*/
+func (m *matcher) walker() *runeWalker[[]bool] {
+	return &runeWalker[[]bool]{
+		step: func(states []bool, r rune) ([]bool, walkAction) {
+			if next := m.step(states, r); next != nil {
+				return next, walkDescend
+			}
+			return nil, walkSkip
+		},
+		entry: func(states []bool, key string, count int64) {
+			if m.accepts(states) {
+				m.members = append(m.members, &MemberInfo{key, count})
+			}
+		},
+	}
+}
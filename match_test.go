@@ -0,0 +1,61 @@
+package trie
+
+import (
+	"testing"
+)
+
+func TestTrieMatch(t *testing.T) {
+	tr := NewTrie()
+	for _, w := range []string{"tea", "teas", "teased", "test", "test", "testing", "toast", "text", "te*t", "日本", "日本語", "月本"} {
+		tr.Add(w)
+	}
+
+	cases := []struct {
+		pattern  string
+		expected []string
+	}{
+		{"te?t", []string{"te*t", "test", "text"}},
+		{"te*", []string{"te*t", "tea", "teas", "teased", "test", "testing", "text"}},
+		{"t*t", []string{"te*t", "test", "text", "toast"}},
+		{"*s*", []string{"teas", "teased", "test", "testing", "toast"}},
+		{"te[a-r]*", []string{"tea", "teas", "teased"}},
+		{"te[!a-r]t", []string{"te*t", "test", "text"}},
+		{"te[^a-rx]t", []string{"te*t", "test"}},
+		{`te\*t`, []string{"te*t"}},
+		{"test", []string{"test"}},
+		{"tes", nil},
+		{"?本", []string{"日本", "月本"}},
+		{"日*", []string{"日本", "日本語"}},
+		{"[日月]本?", []string{"日本語"}},
+		{"*", tr.MembersList()},
+		{"x*", nil},
+	}
+	for _, c := range cases {
+		members, err := tr.Match(c.pattern)
+		if err != nil {
+			t.Errorf("Unexpected error for Match('%s'): %v", c.pattern, err)
+			continue
+		}
+		if len(members) != len(c.expected) {
+			t.Errorf("Expected Match('%s') to be %v, got %v instead.", c.pattern, c.expected, members)
+			continue
+		}
+		for i, mi := range members {
+			if mi.Value != c.expected[i] {
+				t.Errorf("Expected Match('%s') to be %v, got %v instead.", c.pattern, c.expected, members)
+				break
+			}
+		}
+	}
+
+	members, _ := tr.Match("test")
+	if members[0].Count != 2 {
+		t.Errorf("Expected Match('test') to have count 2, got %v instead.", members[0].Count)
+	}
+
+	for _, pattern := range []string{"te[a-", "te[", `te\`, "te[z-a]"} {
+		if _, err := tr.Match(pattern); err != ErrBadPattern {
+			t.Errorf("Expected ErrBadPattern for Match('%s'), got %v instead.", pattern, err)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package trie
+
+/*
+MergeStrategy decides the count of an entry that exists in both Tries of a
+Merge. It gets the entry, its count in the Trie merged into and its count in
+the other Trie. A result of zero or less removes the entry.
+*/
+type MergeStrategy func(key string, existing, other int64) int64
+
+var (
+	// MergeSum adds up the counts - like adding the entries of the other Trie
+	MergeSum MergeStrategy = func(key string, existing, other int64) int64 { return existing + other }
+	// MergeMax keeps the higher count
+	MergeMax MergeStrategy = func(key string, existing, other int64) int64 {
+		if other > existing {
+			return other
+		}
+		return existing
+	}
+	// MergeMin keeps the lower count
+	MergeMin MergeStrategy = func(key string, existing, other int64) int64 {
+		if other < existing {
+			return other
+		}
+		return existing
+	}
+	// MergeKeepExisting keeps the count of the Trie merged into
+	MergeKeepExisting MergeStrategy = func(key string, existing, other int64) int64 { return existing }
+	// MergeOverwrite takes the count of the other Trie
+	MergeOverwrite MergeStrategy = func(key string, existing, other int64) int64 { return other }
+)
+
+/*
+Merge merges all entries of `other` into the Trie. Entries that only exist in
+`other` are added with their count and payload, for entries that exist in both
+Tries `strategy` decides the new count. A nil strategy is MergeSum.
+
+The Branches of both Tries are merged node by node. `other` is copied first and
+is not changed.
+*/
+func (t *Trie) Merge(other *Trie, strategy MergeStrategy) {
+	if strategy == nil {
+		strategy = MergeSum
+	}
+	other.Root.RLock()
+	src := other.Root.deepCopy()
+	other.Root.RUnlock()
+
+	t.Root.Lock()
+	t.version++
+	t.Root.merge(src, []byte{}, strategy, t)
+	t.Root.pullUp()
+	if !t.Root.End && len(t.Root.Branches) == 0 {
+		t.Root.LeafValue = nil
+	}
+	t.Root.updateMaxCount()
+	t.Root.Unlock()
+}
+
+/*
+merge merges `other` into the Branch. Both Branches are at the same position,
+`key` is the entry up to the start of their LeafValues. `other` is taken apart
+and must not be used afterwards. Changed entries are logged to the WAL of `t`.
+*/
+func (b *Branch) merge(other *Branch, key []byte, strategy MergeStrategy, t *Trie) {
+	// split the longer LeafValue so both Branches end at the same position
+	common := 0
+	for common < len(b.LeafValue) && common < len(other.LeafValue) && b.LeafValue[common] == other.LeafValue[common] {
+		common++
+	}
+	if common < len(b.LeafValue) {
+		b.split(common)
+	}
+	if common < len(other.LeafValue) {
+		other.split(common)
+	}
+	key = append(key, b.LeafValue...)
+
+	if other.End {
+		count := other.Count
+		if b.End {
+			count = strategy(string(key), b.Count, other.Count)
+		} else {
+			b.Payload = other.Payload
+		}
+		if count > 0 {
+			b.End, b.Count = true, count
+		} else {
+			b.End, b.Count, b.Payload = false, 0, nil
+		}
+		t.logOp(walSetCount, string(key), count)
+	}
+
+	for idx, ob := range other.Branches {
+		br, present := b.Branches[idx]
+		if !present {
+			b.Branches[idx] = ob
+			if t.wal != nil {
+				for _, mi := range ob.members(append(key, idx), false) {
+					t.logOp(walAdd, mi.Value, mi.Count)
+				}
+			}
+			continue
+		}
+		br.merge(ob, append(key, idx), strategy, t)
+		if !br.End && len(br.Branches) == 0 {
+			delete(b.Branches, idx)
+		} else {
+			br.pullUp()
+			br.updateMaxCount()
+		}
+	}
+	b.updateMaxCount()
+}
+
+/*
+split pushes the LeafValue of the Branch from position `at` on down into a new
+Branch, which takes over the End, Count, Payload and Branches.
+*/
+func (b *Branch) split(at int) {
+	tail := b.LeafValue[at:]
+	newBranch := &Branch{
+		LeafValue: append([]byte{}, tail[1:]...),
+		Branches:  b.Branches,
+		End:       b.End,
+		Count:     b.Count,
+		MaxCount:  b.MaxCount,
+		Payload:   b.Payload,
+	}
+	newBranch.updateDigest()
+	b.LeafValue = append([]byte{}, b.LeafValue[:at]...)
+	b.Branches = map[byte]*Branch{tail[0]: newBranch}
+	b.End, b.Count, b.Payload = false, 0, nil
+}
+
+/*
+deepCopy returns a copy of the Branch and all its Branches.
+*/
+func (b *Branch) deepCopy() *Branch {
+	c := &Branch{
+		LeafValue: append([]byte{}, b.LeafValue...),
+		Branches:  make(map[byte]*Branch, len(b.Branches)),
+		End:       b.End,
+		Count:     b.Count,
+		MaxCount:  b.MaxCount,
+		digest:    b.digest,
+		Payload:   b.Payload,
+	}
+	for idx, br := range b.Branches {
+		c.Branches[idx] = br.deepCopy()
+	}
+	return c
+}
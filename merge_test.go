@@ -0,0 +1,140 @@
+package trie
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestTrieMergeStrategies(t *testing.T) {
+	newTries := func() (*Trie, *Trie) {
+		a, b := NewTrie(), NewTrie()
+		a.AddWithCount("test", 2)
+		a.AddWithCount("tea", 5)
+		a.Put("only a", "a")
+		b.AddWithCount("test", 4)
+		b.AddWithCount("tea", 1)
+		b.AddWithCount("testing", 3)
+		b.Put("only b", "b")
+		return a, b
+	}
+
+	for name, c := range map[string]struct {
+		strategy  MergeStrategy
+		test, tea int64
+	}{
+		"Sum":          {MergeSum, 6, 6},
+		"nil":          {nil, 6, 6},
+		"Max":          {MergeMax, 4, 5},
+		"Min":          {MergeMin, 2, 1},
+		"KeepExisting": {MergeKeepExisting, 2, 5},
+		"Overwrite":    {MergeOverwrite, 4, 1},
+	} {
+		a, b := newTries()
+		bDump := b.Dump()
+		a.Merge(b, c.strategy)
+		if _, cnt := a.HasCount("test"); cnt != c.test {
+			t.Errorf("%s: Expected count for test to be %v. got %v instead.", name, c.test, cnt)
+		}
+		if _, cnt := a.HasCount("tea"); cnt != c.tea {
+			t.Errorf("%s: Expected count for tea to be %v. got %v instead.", name, c.tea, cnt)
+		}
+		if _, cnt := a.HasCount("testing"); cnt != 3 {
+			t.Errorf("%s: Expected count for testing to be 3. got %v instead.", name, cnt)
+		}
+		if v, _ := a.Get("only b"); v != "b" {
+			t.Errorf("%s: Expected the payload of 'only b' to be merged, got %v instead.", name, v)
+		}
+		if v, _ := a.Get("only a"); v != "a" {
+			t.Errorf("%s: Expected the payload of 'only a' to be kept, got %v instead.", name, v)
+		}
+		if b.Dump() != bDump {
+			t.Errorf("%s: Expected the other Trie to be unchanged.", name)
+		}
+	}
+
+	// a custom strategy that drops entries that exist in both
+	a, b := newTries()
+	var keys []string
+	a.Merge(b, func(key string, existing, other int64) int64 {
+		keys = append(keys, key)
+		return 0
+	})
+	sort.Strings(keys)
+	if len(keys) != 2 || keys[0] != "tea" || keys[1] != "test" {
+		t.Errorf("Expected the strategy to be called for tea and test, got %v instead.", keys)
+	}
+	expected := []string{"only a", "only b", "testing"}
+	members := a.MembersList()
+	if len(members) != len(expected) {
+		t.Fatalf("Expected members %v, got %v instead.", expected, members)
+	}
+	for i, m := range members {
+		if m != expected[i] {
+			t.Errorf("Expected member %v to be %s, got %s instead.", i, expected[i], m)
+		}
+	}
+
+	// merging a Trie into itself
+	a, _ = newTries()
+	a.Merge(a, MergeSum)
+	if _, cnt := a.HasCount("tea"); cnt != 10 {
+		t.Errorf("Expected count for tea to be 10. got %v instead.", cnt)
+	}
+}
+
+func TestTrieMergeRandom(t *testing.T) {
+	// every other round uses a strategy that removes entries
+	subtract := func(key string, existing, other int64) int64 { return existing - other }
+	for round := 0; round < 20; round++ {
+		strategy := MergeMax
+		if round%2 == 1 {
+			strategy = subtract
+		}
+		a, b := NewTrie(), NewTrie()
+		counts := make(map[string]int64)
+		for _, tr := range []*Trie{a, b} {
+			for n := 0; n < 200; n++ {
+				str := []byte{}
+				for i := 0; i < rand.Intn(6); i++ {
+					str = append(str, byte('a'+rand.Intn(3)))
+				}
+				if len(str) == 0 {
+					continue
+				}
+				tr.Add(string(str))
+			}
+		}
+		for _, mi := range a.Members() {
+			counts[mi.Value] = mi.Count
+		}
+		for _, mi := range b.Members() {
+			if existing, ok := counts[mi.Value]; ok {
+				counts[mi.Value] = strategy(mi.Value, existing, mi.Count)
+			} else {
+				counts[mi.Value] = mi.Count
+			}
+		}
+
+		a.Merge(b, strategy)
+
+		var keys []string
+		for k, c := range counts {
+			if c > 0 {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		var members []*MemberInfo
+		for _, k := range keys {
+			members = append(members, &MemberInfo{k, counts[k]})
+		}
+		expected := &Trie{Root: buildFromSortedMembers(members)}
+		if a.Dump() != expected.Dump() {
+			t.Fatalf("Expected merged Trie\n%s\ngot\n%s\ninstead.", expected.Dump(), a.Dump())
+		}
+		if a.Root.MaxCount != expected.Root.MaxCount {
+			t.Errorf("Expected MaxCount %v, got %v instead.", expected.Root.MaxCount, a.Root.MaxCount)
+		}
+	}
+}
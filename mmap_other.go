@@ -0,0 +1,18 @@
+//go:build !unix
+
+package trie
+
+import (
+	"io"
+	"os"
+)
+
+/*
+mapFile reads the content of `f` into memory on platforms without mmap.
+*/
+func mapFile(f *os.File) (data []byte, unmap func() error, err error) {
+	if data, err = io.ReadAll(f); err != nil {
+		return
+	}
+	return data, func() error { return nil }, nil
+}
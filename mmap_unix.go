@@ -0,0 +1,27 @@
+//go:build unix
+
+package trie
+
+import (
+	"os"
+	"syscall"
+)
+
+/*
+mapFile maps the content of `f` read-only into memory.
+*/
+func mapFile(f *os.File) (data []byte, unmap func() error, err error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return
+	}
+	size := fi.Size()
+	if size == 0 || int64(int(size)) != size {
+		return nil, nil, ErrBadMapped
+	}
+	data, err = syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return
+	}
+	return data, func() error { return syscall.Munmap(data) }, nil
+}
@@ -0,0 +1,203 @@
+package trie
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+/*
+PersistentTrie is a Trie variant for read heavy workloads. Writes never modify
+existing Branches: Add and Delete copy the Branches along the path of the entry
+and atomically swap in the new Root. Readers take a Snapshot - an immutable view
+of the Trie at that time - and query it without any locking while writes go on.
+
+Writers are serialized by a mutex.
+*/
+type PersistentTrie struct {
+	mu   sync.Mutex
+	root atomic.Value
+}
+
+/*
+NewPersistentTrie returns the pointer to a new PersistentTrie with an
+initialized root Branch
+*/
+func NewPersistentTrie() *PersistentTrie {
+	t := &PersistentTrie{}
+	t.root.Store(&Branch{
+		Branches: make(map[byte]*Branch),
+	})
+	return t
+}
+
+/*
+Add adds an entry to the PersistentTrie.
+*/
+func (t *PersistentTrie) Add(entry string) {
+	t.mu.Lock()
+	root := t.load().clonePath([]byte(entry))
+	root.add([]byte(entry))
+	t.root.Store(root)
+	t.mu.Unlock()
+}
+
+/*
+Delete decrements the count of an existing entry by one - see Trie.Delete.
+*/
+func (t *PersistentTrie) Delete(entry string) bool {
+	if len(entry) == 0 {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	root := t.load()
+	if !root.has([]byte(entry)) {
+		return false
+	}
+	root = root.clonePath([]byte(entry))
+	deleted := root.delete([]byte(entry))
+	t.root.Store(root)
+	return deleted
+}
+
+/*
+Snapshot returns an immutable view of the current state of the PersistentTrie.
+*/
+func (t *PersistentTrie) Snapshot() *Snapshot {
+	return &Snapshot{root: t.load()}
+}
+
+func (t *PersistentTrie) load() *Branch {
+	return t.root.Load().(*Branch)
+}
+
+/*
+clonePath returns a copy of the Branch in which all Branches along the path of
+`entry` are copied as well. All other Branches are shared with the original.
+add and delete only modify Branches on the path of the entry, so they can be
+run on the copy without affecting the original.
+*/
+func (b *Branch) clonePath(entry []byte) *Branch {
+	c := &Branch{
+		Branches:  make(map[byte]*Branch, len(b.Branches)),
+		LeafValue: b.LeafValue,
+		End:       b.End,
+		Count:     b.Count,
+		MaxCount:  b.MaxCount,
+		digest:    b.digest,
+		Payload:   b.Payload,
+	}
+	for idx, br := range b.Branches {
+		c.Branches[idx] = br
+	}
+
+	leafLen := len(b.LeafValue)
+	if len(entry) <= leafLen {
+		return c
+	}
+	for i, lb := range b.LeafValue {
+		if entry[i] != lb {
+			return c
+		}
+	}
+	if br, present := b.Branches[entry[leafLen]]; present {
+		c.Branches[entry[leafLen]] = br.clonePath(entry[leafLen+1:])
+	}
+	return c
+}
+
+/*
+Snapshot is an immutable view of a PersistentTrie. It is safe for concurrent
+use without any locking.
+*/
+type Snapshot struct {
+	root *Branch
+}
+
+/*
+Has returns true if the `entry` exists in the `Snapshot`
+*/
+func (s *Snapshot) Has(entry string) bool {
+	return s.root.has([]byte(entry))
+}
+
+/*
+HasCount returns true if the `entry` exists in the `Snapshot`. The second
+returned value is the count how often the entry has been set.
+*/
+func (s *Snapshot) HasCount(entry string) (exists bool, count int64) {
+	return s.root.hasCount([]byte(entry))
+}
+
+/*
+HasPrefix returns true if the the `Snapshot` contains entries with the given
+prefix
+*/
+func (s *Snapshot) HasPrefix(prefix string) bool {
+	return s.root.hasPrefix([]byte(prefix))
+}
+
+/*
+HasPrefixCount returns true if the the `Snapshot` contains entries with the
+given prefix. The second returned value is the sum of the counts of these
+entries.
+*/
+func (s *Snapshot) HasPrefixCount(prefix string) (exists bool, count int64) {
+	return s.root.hasPrefixCount([]byte(prefix))
+}
+
+/*
+Members returns all entries of the Snapshot with their counts as MemberInfo in
+lexicographic (byte) order
+*/
+func (s *Snapshot) Members() []*MemberInfo {
+	return s.root.members([]byte{}, false)
+}
+
+/*
+MembersList returns a Slice of all entries of the Snapshot in lexicographic
+(byte) order
+*/
+func (s *Snapshot) MembersList() (members []string) {
+	for _, mi := range s.root.members([]byte{}, false) {
+		members = append(members, mi.Value)
+	}
+	return
+}
+
+/*
+PrefixMembers returns all entries of the Snapshot that have the given prefix
+with their counts as MemberInfo in lexicographic (byte) order
+*/
+func (s *Snapshot) PrefixMembers(prefix string) []*MemberInfo {
+	return s.root.prefixMembers([]byte{}, []byte(prefix), false)
+}
+
+/*
+PrefixMembersList returns a List of all entries of the Snapshot that have the
+given prefix in lexicographic (byte) order
+*/
+func (s *Snapshot) PrefixMembersList(prefix string) (members []string) {
+	for _, mi := range s.root.prefixMembers([]byte{}, []byte(prefix), false) {
+		members = append(members, mi.Value)
+	}
+	return
+}
+
+/*
+Walk calls `fn` for every entry of the Snapshot that has the given prefix in
+lexicographic (byte) order. The walk stops as soon as `fn` returns false.
+*/
+func (s *Snapshot) Walk(prefix string, fn func(key string, count int64) bool) {
+	exists, br, matchedPrefix := s.root.hasPrefixBranch([]byte(prefix))
+	if exists {
+		br.walk(matchedPrefix, fn)
+	}
+}
+
+/*
+Dump returns a string representation of the `Snapshot`
+*/
+func (s *Snapshot) Dump() string {
+	return s.root.Dump(0)
+}
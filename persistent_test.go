@@ -0,0 +1,132 @@
+package trie
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+func TestPersistentTrieSnapshot(t *testing.T) {
+	tr := NewPersistentTrie()
+	tr.Add("test")
+	tr.Add("test")
+	tr.Add("testing")
+	tr.Add("tea")
+
+	s1 := tr.Snapshot()
+	dump := s1.Dump()
+
+	tr.Add("te")
+	tr.Add("toast")
+	tr.Delete("test")
+	tr.Delete("tea")
+
+	if s1.Dump() != dump {
+		t.Errorf("Expected the Snapshot to be unchanged, got\n%s\ninstead of\n%s", s1.Dump(), dump)
+	}
+	if _, c := s1.HasCount("test"); c != 2 {
+		t.Errorf("Expected count for test in the Snapshot to be 2. got %v instead.", c)
+	}
+	if !s1.Has("tea") || s1.Has("te") || s1.Has("toast") {
+		t.Errorf("Unexpected members of the Snapshot: %v", s1.Members())
+	}
+
+	s2 := tr.Snapshot()
+	expected := []string{"te", "test", "testing", "toast"}
+	members := s2.MembersList()
+	if len(members) != len(expected) {
+		t.Fatalf("Expected the new Snapshot to have members %v, got %v instead.", expected, members)
+	}
+	for i, m := range members {
+		if m != expected[i] {
+			t.Errorf("Expected member %v to be %s, got %s instead.", i, expected[i], m)
+		}
+	}
+	if _, c := s2.HasCount("test"); c != 1 {
+		t.Errorf("Expected count for test to be 1. got %v instead.", c)
+	}
+	if _, c := s2.HasPrefixCount("tes"); c != 2 {
+		t.Errorf("Expected prefix count for tes to be 2. got %v instead.", c)
+	}
+	if !s2.HasPrefix("toa") || s2.HasPrefix("tea") {
+		t.Error("Unexpected HasPrefix result")
+	}
+	if l := s2.PrefixMembersList("tes"); len(l) != 2 {
+		t.Errorf("Expected PrefixMembersList('tes') to have length 2, got %v instead.", l)
+	}
+
+	if tr.Delete("nope") || tr.Delete("") {
+		t.Error("Expected Delete of a missing entry to return false")
+	}
+}
+
+func TestPersistentTrieRandom(t *testing.T) {
+	tr := NewPersistentTrie()
+	ref := NewTrie()
+	var snapshots []*Snapshot
+	var dumps []string
+	for n := 0; n < 2000; n++ {
+		str := []byte{}
+		for i := 0; i < 1+rand.Intn(5); i++ {
+			str = append(str, byte('a'+rand.Intn(3)))
+		}
+		if rand.Intn(3) == 0 {
+			if tr.Delete(string(str)) != ref.Delete(string(str)) {
+				t.Fatalf("Delete('%s') differs from Trie.Delete", str)
+			}
+		} else {
+			tr.Add(string(str))
+			ref.Add(string(str))
+		}
+		if n%100 == 0 {
+			s := tr.Snapshot()
+			snapshots = append(snapshots, s)
+			dumps = append(dumps, s.Dump())
+		}
+	}
+
+	expected := ref.Members()
+	members := tr.Snapshot().Members()
+	if len(members) != len(expected) {
+		t.Fatalf("Expected %v members, got %v instead.", len(expected), len(members))
+	}
+	for i, mi := range expected {
+		if members[i].Value != mi.Value || members[i].Count != mi.Count {
+			t.Errorf("Expected member %v to be %v, got %v instead.", i, mi, members[i])
+		}
+	}
+	for i, s := range snapshots {
+		if s.Dump() != dumps[i] {
+			t.Errorf("Expected Snapshot %v to be unchanged.", i)
+		}
+	}
+}
+
+func TestPersistentTrieConcurrent(t *testing.T) {
+	tr := NewPersistentTrie()
+	words := []string{"foodie", "foods", "foodchain", "foodcrave", "food", "人", "日本", "日本語学校", "学校", "日本語"}
+	wg := sync.WaitGroup{}
+	wg.Add(5)
+	go func() {
+		for i := 0; i < 500; i++ {
+			tr.Add(words[i%len(words)])
+			if i%2 == 0 {
+				tr.Delete(words[(i+3)%len(words)])
+			}
+		}
+		wg.Done()
+	}()
+	for n := 0; n < 4; n++ {
+		go func() {
+			for i := 0; i < 500; i++ {
+				s := tr.Snapshot()
+				s.Has(words[i%len(words)])
+				s.HasPrefixCount("foo")
+				s.PrefixMembers("日本")
+				s.Walk("", func(key string, count int64) bool { return true })
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,158 @@
+package trie
+
+import (
+	"errors"
+	"fmt"
+	"regexp/syntax"
+)
+
+/*
+RegexpMembers returns all entries of the Trie that match the regular expression
+`expr` (in the syntax of the regexp package) with their counts as MemberInfo in
+lexicographic (byte) order. Like regexp.MatchString a match anywhere in an entry
+counts - use ^ and $ to match whole entries.
+
+The compiled expression is run along the Trie, so subtrees that can not match
+anymore are skipped and as soon as a prefix of an entry matches all entries
+below it are taken without running the expression any further. Expressions
+anchored with ^ benefit the most from this.
+*/
+func (t *Trie) RegexpMembers(expr string) (members []*MemberInfo, err error) {
+	re, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return
+	}
+	return t.RegexpMembersSyntax(re)
+}
+
+/*
+RegexpMembersSyntax works like RegexpMembers but takes an already parsed
+regular expression.
+*/
+func (t *Trie) RegexpMembersSyntax(re *syntax.Regexp) (members []*MemberInfo, err error) {
+	t.Root.RLock()
+	defer t.Root.RUnlock()
+	prog, err := syntax.Compile(re.Simplify())
+	if err != nil {
+		err = errors.New(fmt.Sprintf("Could not compile regular expression: %v", err))
+		return
+	}
+	rm := &regexpMatcher{
+		prog:     prog,
+		anchored: prog.StartCond()&syntax.EmptyBeginText != 0,
+	}
+	rm.walker().walk(t.Root, []byte{}, 0, &regexpState{pcs: []uint32{uint32(prog.Start)}, prev: -1})
+	return rm.members, nil
+}
+
+/*
+regexpMatcher runs a compiled regular expression as an NFA along the Branches
+of a Trie.
+*/
+type regexpMatcher struct {
+	prog     *syntax.Prog
+	anchored bool
+	members  []*MemberInfo
+}
+
+/*
+regexpState is the state of the NFA after a part of an entry. `pcs` are the
+instructions of all threads - not yet followed through empty width instructions
+since those depend on the next rune. `prev` is the last rune (-1 at the start).
+*/
+type regexpState struct {
+	pcs  []uint32
+	prev rune
+}
+
+/*
+walker returns the runeWalker that runs the NFA along a Trie and collects all
+matching entries.
+*/
+func (rm *regexpMatcher) walker() *runeWalker[*regexpState] {
+	return &runeWalker[*regexpState]{
+		step: rm.step,
+		entry: func(st *regexpState, key string, count int64) {
+			if _, matched := rm.closure(st.pcs, syntax.EmptyOpContext(st.prev, -1)); matched {
+				rm.members = append(rm.members, &MemberInfo{key, count})
+			}
+		},
+		take: func(st *regexpState, b *Branch, branchPrefix []byte) {
+			rm.collect(b, branchPrefix)
+		},
+	}
+}
+
+/*
+collect adds all entries of `b` prepended with `branchPrefix`.
+*/
+func (rm *regexpMatcher) collect(b *Branch, branchPrefix []byte) {
+	b.walk(branchPrefix, func(key string, count int64) bool {
+		rm.members = append(rm.members, &MemberInfo{key, count})
+		return true
+	})
+}
+
+/*
+step advances the NFA by the rune `r`. If the expression matched the part of
+the entry before `r` every entry starting with it matches and all of them are
+taken. If no thread is left none of them can match.
+*/
+func (rm *regexpMatcher) step(st *regexpState, r rune) (*regexpState, walkAction) {
+	closed, matched := rm.closure(st.pcs, syntax.EmptyOpContext(st.prev, r))
+	if matched {
+		return nil, walkTake
+	}
+	next := &regexpState{prev: r}
+	for _, pc := range closed {
+		inst := &rm.prog.Inst[pc]
+		switch inst.Op {
+		case syntax.InstRune, syntax.InstRune1, syntax.InstRuneAny, syntax.InstRuneAnyNotNL:
+			if inst.MatchRune(r) {
+				next.pcs = append(next.pcs, inst.Out)
+			}
+		}
+	}
+	if !rm.anchored {
+		next.pcs = append(next.pcs, uint32(rm.prog.Start))
+	}
+	if len(next.pcs) == 0 {
+		return nil, walkSkip
+	}
+	return next, walkDescend
+}
+
+/*
+closure follows all threads in `pcs` through the instructions that do not
+consume a rune, with `ctx` describing the position between the previous and
+the next rune. It returns the reachable instructions and whether the match
+instruction is among them.
+*/
+func (rm *regexpMatcher) closure(pcs []uint32, ctx syntax.EmptyOp) (closed []uint32, matched bool) {
+	seen := make([]bool, len(rm.prog.Inst))
+	stack := append([]uint32{}, pcs...)
+	for len(stack) > 0 {
+		pc := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if seen[pc] {
+			continue
+		}
+		seen[pc] = true
+		inst := &rm.prog.Inst[pc]
+		switch inst.Op {
+		case syntax.InstMatch:
+			matched = true
+		case syntax.InstAlt, syntax.InstAltMatch:
+			stack = append(stack, inst.Out, inst.Arg)
+		case syntax.InstCapture, syntax.InstNop:
+			stack = append(stack, inst.Out)
+		case syntax.InstEmptyWidth:
+			if syntax.EmptyOp(inst.Arg)&^ctx == 0 {
+				stack = append(stack, inst.Out)
+			}
+		default:
+			closed = append(closed, pc)
+		}
+	}
+	return
+}
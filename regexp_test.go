@@ -0,0 +1,91 @@
+package trie
+
+import (
+	"math/rand"
+	"regexp"
+	"testing"
+)
+
+func TestTrieRegexpMembers(t *testing.T) {
+	tr := NewTrie()
+	for _, w := range []string{"tea", "teas", "teased", "test", "test", "testing", "toast", "text", "日本", "日本語", "月本", "foo bar"} {
+		tr.Add(w)
+	}
+
+	cases := []struct {
+		expr     string
+		expected []string
+	}{
+		{"^te.t$", []string{"test", "text"}},
+		{"^te", []string{"tea", "teas", "teased", "test", "testing", "text"}},
+		{"st", []string{"test", "testing", "toast"}},
+		{"^t[aeo]+s", []string{"teas", "teased", "test", "testing", "toast"}},
+		{"ing$", []string{"testing"}},
+		{`^.本$`, []string{"日本", "月本"}},
+		{"語", []string{"日本語"}},
+		{`\bbar`, []string{"foo bar"}},
+		{`^(tea|foo)\b`, []string{"foo bar", "tea"}},
+		{"^x", nil},
+		{"", tr.MembersList()},
+	}
+	for _, c := range cases {
+		members, err := tr.RegexpMembers(c.expr)
+		if err != nil {
+			t.Errorf("Unexpected error for RegexpMembers('%s'): %v", c.expr, err)
+			continue
+		}
+		if len(members) != len(c.expected) {
+			t.Errorf("Expected RegexpMembers('%s') to be %v, got %v instead.", c.expr, c.expected, members)
+			continue
+		}
+		for i, mi := range members {
+			if mi.Value != c.expected[i] {
+				t.Errorf("Expected RegexpMembers('%s') to be %v, got %v instead.", c.expr, c.expected, members)
+				break
+			}
+		}
+	}
+
+	members, _ := tr.RegexpMembers("^test$")
+	if len(members) != 1 || members[0].Count != 2 {
+		t.Errorf("Expected RegexpMembers('^test$') to be [test(2)], got %v instead.", members)
+	}
+
+	if _, err := tr.RegexpMembers("te(st"); err == nil {
+		t.Error("Expected RegexpMembers('te(st') to fail")
+	}
+}
+
+func TestTrieRegexpMembersRandom(t *testing.T) {
+	tr := NewTrie()
+	for n := 0; n < 1000; n++ {
+		str := []byte{}
+		for i := 0; i < 1+rand.Intn(8); i++ {
+			str = append(str, byte('a'+rand.Intn(4)))
+		}
+		tr.Add(string(str))
+	}
+
+	for _, expr := range []string{"^ab*c", "a[bc]d", "(ab|ba)+$", "^a.?b.*d$", `\Ac`, "b{2,3}"} {
+		re := regexp.MustCompile(expr)
+		var expected []string
+		for _, w := range tr.MembersList() {
+			if re.MatchString(w) {
+				expected = append(expected, w)
+			}
+		}
+		members, err := tr.RegexpMembers(expr)
+		if err != nil {
+			t.Fatalf("Unexpected error for RegexpMembers('%s'): %v", expr, err)
+		}
+		if len(members) != len(expected) {
+			t.Errorf("Expected RegexpMembers('%s') to return %v entries, got %v instead.", expr, len(expected), len(members))
+			continue
+		}
+		for i, mi := range members {
+			if mi.Value != expected[i] {
+				t.Errorf("Expected RegexpMembers('%s') entry %v to be %s, got %s instead.", expr, i, expected[i], mi.Value)
+			}
+		}
+	}
+}
@@ -0,0 +1,417 @@
+package trie
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+/*
+RuneTrie is a Trie whose Branches split off by rune instead of by byte. Edges
+and LeafValues only ever split on rune boundaries, so a prefix that ends in the
+middle of a multibyte character never matches and dumps of non ASCII entries
+stay readable.
+
+Entries have to be valid UTF-8. A RuneTrie is safe for concurrent use in the
+same way as a Trie.
+*/
+type RuneTrie struct {
+	Root *RuneBranch
+}
+
+/*
+RuneBranch is the Branch of a RuneTrie.
+*/
+type RuneBranch struct {
+	sync.RWMutex
+	Branches  map[rune]*RuneBranch
+	LeafValue []rune
+	End       bool
+	Count     int64
+}
+
+/*
+NewRuneTrie returns the pointer to a new RuneTrie with an initialized root
+Branch
+*/
+func NewRuneTrie() *RuneTrie {
+	return &RuneTrie{
+		Root: newRuneBranch(),
+	}
+}
+
+func newRuneBranch() *RuneBranch {
+	return &RuneBranch{
+		Branches: make(map[rune]*RuneBranch),
+	}
+}
+
+/*
+Add adds an entry to the RuneTrie and returns the Branch the end of the entry
+was marked at. An entry that is not valid UTF-8 is not added and nil is
+returned.
+*/
+func (t *RuneTrie) Add(entry string) *RuneBranch {
+	if !utf8.ValidString(entry) {
+		return nil
+	}
+	t.Root.Lock()
+	b := t.Root.add([]rune(entry))
+	t.Root.Unlock()
+	return b
+}
+
+/*
+Delete decrements the count of an existing entry by one and removes it once
+the count drops to zero. Returns true if the entry existed.
+*/
+func (t *RuneTrie) Delete(entry string) bool {
+	if len(entry) == 0 || !utf8.ValidString(entry) {
+		return false
+	}
+	t.Root.Lock()
+	defer t.Root.Unlock()
+	if !t.Root.delete([]rune(entry)) {
+		return false
+	}
+	t.Root.pullUp()
+	if !t.Root.End && len(t.Root.Branches) == 0 {
+		t.Root.LeafValue = nil
+	}
+	return true
+}
+
+/*
+Has returns true if the `entry` exists in the `RuneTrie`
+*/
+func (t *RuneTrie) Has(entry string) bool {
+	exists, _ := t.HasCount(entry)
+	return exists
+}
+
+/*
+HasCount returns true if the `entry` exists in the `RuneTrie`. The second
+returned value is the count how often the entry has been set.
+*/
+func (t *RuneTrie) HasCount(entry string) (exists bool, count int64) {
+	if !utf8.ValidString(entry) {
+		return
+	}
+	t.Root.RLock()
+	defer t.Root.RUnlock()
+	if b := t.Root.getBranch([]rune(entry)); b != nil {
+		return true, b.Count
+	}
+	return
+}
+
+/*
+HasPrefix returns true if the the `RuneTrie` contains entries with the given
+prefix. A prefix that ends in an incomplete rune does not match.
+*/
+func (t *RuneTrie) HasPrefix(prefix string) bool {
+	exists, _ := t.HasPrefixCount(prefix)
+	return exists
+}
+
+/*
+HasPrefixCount returns true if the the `RuneTrie` contains entries with the
+given prefix. The second returned value is the sum of the counts of these
+entries.
+*/
+func (t *RuneTrie) HasPrefixCount(prefix string) (exists bool, count int64) {
+	if !utf8.ValidString(prefix) {
+		return
+	}
+	t.Root.RLock()
+	defer t.Root.RUnlock()
+	if b, _ := t.Root.prefixBranch([]rune(prefix), nil); b != nil {
+		return true, b.sumCount()
+	}
+	return
+}
+
+/*
+Members returns all entries of the RuneTrie with their counts as MemberInfo in
+lexicographic order
+*/
+func (t *RuneTrie) Members() []*MemberInfo {
+	return t.PrefixMembers("")
+}
+
+/*
+MembersList returns a Slice of all entries of the RuneTrie in lexicographic
+order
+*/
+func (t *RuneTrie) MembersList() (members []string) {
+	for _, mi := range t.Members() {
+		members = append(members, mi.Value)
+	}
+	return
+}
+
+/*
+PrefixMembers returns all entries of the RuneTrie that have the given prefix
+with their counts as MemberInfo in lexicographic order
+*/
+func (t *RuneTrie) PrefixMembers(prefix string) (members []*MemberInfo) {
+	if !utf8.ValidString(prefix) {
+		return
+	}
+	t.Root.RLock()
+	defer t.Root.RUnlock()
+	b, path := t.Root.prefixBranch([]rune(prefix), nil)
+	if b != nil {
+		// path already holds the LeafValue of b
+		members = b.members(path[:len(path)-len(b.LeafValue)], members)
+	}
+	return
+}
+
+/*
+PrefixMembersList returns a List of all entries of the RuneTrie that have the
+given prefix in lexicographic order
+*/
+func (t *RuneTrie) PrefixMembersList(prefix string) (members []string) {
+	for _, mi := range t.PrefixMembers(prefix) {
+		members = append(members, mi.Value)
+	}
+	return
+}
+
+/*
+Dump returns a string representation of the `RuneTrie`
+*/
+func (t *RuneTrie) Dump() string {
+	t.Root.RLock()
+	defer t.Root.RUnlock()
+	return t.Root.Dump(0)
+}
+
+/*
+PrintDump prints the Dump of the `RuneTrie`
+*/
+func (t *RuneTrie) PrintDump() {
+	fmt.Print(t.Dump())
+}
+
+/*
+add adds an entry to the Branch and returns the Branch the end of the entry is
+marked at.
+*/
+func (b *RuneBranch) add(entry []rune) *RuneBranch {
+	// an empty branch takes the whole entry as its LeafValue
+	if len(b.LeafValue) == 0 && len(b.Branches) == 0 && !b.End {
+		b.LeafValue = entry
+		b.End, b.Count = true, 1
+		return b
+	}
+
+	common := 0
+	for common < len(b.LeafValue) && common < len(entry) && b.LeafValue[common] == entry[common] {
+		common++
+	}
+	if common < len(b.LeafValue) {
+		b.split(common)
+	}
+	if common == len(entry) {
+		b.End = true
+		b.Count++
+		return b
+	}
+
+	idx := entry[common]
+	next, present := b.Branches[idx]
+	if !present {
+		next = newRuneBranch()
+		b.Branches[idx] = next
+	}
+	return next.add(entry[common+1:])
+}
+
+/*
+split pushes the LeafValue of the Branch from position `at` on down into a new
+Branch, which takes over the End, Count and Branches.
+*/
+func (b *RuneBranch) split(at int) {
+	newBranch := &RuneBranch{
+		Branches:  b.Branches,
+		LeafValue: b.LeafValue[at+1:],
+		End:       b.End,
+		Count:     b.Count,
+	}
+	b.Branches = map[rune]*RuneBranch{b.LeafValue[at]: newBranch}
+	b.LeafValue = b.LeafValue[:at:at]
+	b.End, b.Count = false, 0
+}
+
+/*
+delete decrements the count of an entry of the Branch. Branches that end up
+empty are removed and a Branch left with a single Branch is merged with it.
+*/
+func (b *RuneBranch) delete(entry []rune) bool {
+	if len(entry) < len(b.LeafValue) || !runesEqual(entry[:len(b.LeafValue)], b.LeafValue) {
+		return false
+	}
+	rest := entry[len(b.LeafValue):]
+	if len(rest) == 0 {
+		if !b.End {
+			return false
+		}
+		if b.Count--; b.Count <= 0 {
+			b.End, b.Count = false, 0
+		}
+		return true
+	}
+
+	next, present := b.Branches[rest[0]]
+	if !present || !next.delete(rest[1:]) {
+		return false
+	}
+	if !next.End && len(next.Branches) == 0 {
+		delete(b.Branches, rest[0])
+	} else {
+		next.pullUp()
+	}
+	return true
+}
+
+/*
+pullUp merges a Branch that does not mark an End with its only Branch.
+*/
+func (b *RuneBranch) pullUp() {
+	for !b.End && len(b.Branches) == 1 {
+		for idx, next := range b.Branches {
+			leaf := make([]rune, 0, len(b.LeafValue)+1+len(next.LeafValue))
+			leaf = append(append(append(leaf, b.LeafValue...), idx), next.LeafValue...)
+			b.LeafValue = leaf
+			b.Branches, b.End, b.Count = next.Branches, next.End, next.Count
+		}
+	}
+}
+
+/*
+getBranch returns the Branch the entry ends at or nil if it does not exist.
+*/
+func (b *RuneBranch) getBranch(entry []rune) *RuneBranch {
+	for {
+		if len(entry) < len(b.LeafValue) || !runesEqual(entry[:len(b.LeafValue)], b.LeafValue) {
+			return nil
+		}
+		entry = entry[len(b.LeafValue):]
+		if len(entry) == 0 {
+			if b.End {
+				return b
+			}
+			return nil
+		}
+		next, present := b.Branches[entry[0]]
+		if !present {
+			return nil
+		}
+		b, entry = next, entry[1:]
+	}
+}
+
+/*
+prefixBranch returns the Branch whose path contains `prefix` and the whole
+path up to the end of its LeafValue appended to `path`. The Branch is nil if
+no entry has the prefix.
+*/
+func (b *RuneBranch) prefixBranch(prefix []rune, path []rune) (*RuneBranch, []rune) {
+	for {
+		leafLen := len(b.LeafValue)
+		if len(prefix) <= leafLen {
+			if !runesEqual(prefix, b.LeafValue[:len(prefix)]) {
+				return nil, nil
+			}
+			return b, append(path, b.LeafValue...)
+		}
+		if !runesEqual(prefix[:leafLen], b.LeafValue) {
+			return nil, nil
+		}
+		next, present := b.Branches[prefix[leafLen]]
+		if !present {
+			return nil, nil
+		}
+		path = append(append(path, b.LeafValue...), prefix[leafLen])
+		b, prefix = next, prefix[leafLen+1:]
+	}
+}
+
+func (b *RuneBranch) sumCount() (count int64) {
+	if b.End {
+		count = b.Count
+	}
+	for _, br := range b.Branches {
+		count += br.sumCount()
+	}
+	return
+}
+
+/*
+members appends all entries of the Branch prepended with `branchPrefix` to
+`members` in lexicographic order.
+*/
+func (b *RuneBranch) members(branchPrefix []rune, members []*MemberInfo) []*MemberInfo {
+	key := append(branchPrefix, b.LeafValue...)
+	if b.End {
+		members = append(members, &MemberInfo{string(key), b.Count})
+	}
+	for _, idx := range b.sortedIdxs() {
+		members = b.Branches[idx].members(append(key, idx), members)
+	}
+	return members
+}
+
+func (b *RuneBranch) sortedIdxs() []rune {
+	idxs := make([]rune, 0, len(b.Branches))
+	for idx := range b.Branches {
+		idxs = append(idxs, idx)
+	}
+	sort.Slice(idxs, func(i, j int) bool { return idxs[i] < idxs[j] })
+	return idxs
+}
+
+/*
+Dump returns a string representation of the Branch in the same format as
+Branch.Dump. Indexes and LeafValues are printed as whole characters.
+*/
+func (b *RuneBranch) Dump(depth int) (out string) {
+	if len(b.LeafValue) > 0 {
+		if b.End {
+			out += fmt.Sprintf("%s V:%v (%v)\n", strings.Repeat(PADDING_CHAR, depth), string(b.LeafValue), b.Count)
+		} else {
+			out += fmt.Sprintf("%s V:%v (%v)\n", strings.Repeat(PADDING_CHAR, depth), string(b.LeafValue), "-")
+		}
+	}
+
+	if b.End {
+		out += fmt.Sprintf("%s $\n", strings.Repeat(PADDING_CHAR, depth+len(b.LeafValue)))
+	}
+
+	for _, idx := range b.sortedIdxs() {
+		branch := b.Branches[idx]
+		if branch.End && len(branch.LeafValue) == 0 {
+			out += fmt.Sprintf("%s I:%v (%v)\n", strings.Repeat(PADDING_CHAR, depth+len(b.LeafValue)), string(idx), branch.Count)
+		} else {
+			out += fmt.Sprintf("%s I:%v (%v)\n", strings.Repeat(PADDING_CHAR, depth+len(b.LeafValue)), string(idx), "-")
+		}
+		out += branch.Dump(depth + len(b.LeafValue) + 1)
+	}
+	return
+}
+
+func runesEqual(a, b []rune) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
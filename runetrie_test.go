@@ -0,0 +1,119 @@
+package trie
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestRuneTrie(t *testing.T) {
+	tr := NewRuneTrie()
+	for _, w := range []string{"日本", "日本語", "日本語学校", "日光", "学校", "test", "test", "tea", "é", "ã"} {
+		tr.Add(w)
+	}
+
+	expected := []string{"tea", "test", "ã", "é", "学校", "日光", "日本", "日本語", "日本語学校"}
+	members := tr.MembersList()
+	if strings.Join(members, " ") != strings.Join(expected, " ") {
+		t.Errorf("Expected members %v, got %v instead.", expected, members)
+	}
+	if _, c := tr.HasCount("test"); c != 2 {
+		t.Errorf("Expected count for test to be 2. got %v instead.", c)
+	}
+	if !tr.Has("日本") || tr.Has("日") || tr.Has("日本語学") {
+		t.Error("Unexpected Has result")
+	}
+
+	// "日" is e6 97 a5 - a prefix ending within it must not match
+	if tr.HasPrefix("日"[:2]) || tr.HasPrefix("\xc3") || tr.HasPrefix("日本"[:4]) {
+		t.Error("Expected a prefix with a partial rune not to match")
+	}
+	if tr.PrefixMembers("日"[:1]) != nil {
+		t.Error("Expected no members for a prefix with a partial rune")
+	}
+	if !tr.HasPrefix("日") || !tr.HasPrefix("") || tr.HasPrefix("x") {
+		t.Error("Unexpected HasPrefix result")
+	}
+	if _, c := tr.HasPrefixCount("日本"); c != 3 {
+		t.Errorf("Expected prefix count for 日本 to be 3. got %v instead.", c)
+	}
+	if l := tr.PrefixMembersList("日本語"); len(l) != 2 || l[0] != "日本語" || l[1] != "日本語学校" {
+		t.Errorf("Expected PrefixMembersList('日本語') to be [日本語 日本語学校], got %v instead.", l)
+	}
+	if l := tr.PrefixMembersList("日本語学"); len(l) != 1 || l[0] != "日本語学校" {
+		t.Errorf("Expected PrefixMembersList('日本語学') to be [日本語学校], got %v instead.", l)
+	}
+
+	dump := tr.Dump()
+	if !strings.Contains(dump, "I:日 (-)") || !strings.Contains(dump, "V:校 (1)") || !utf8.ValidString(dump) {
+		t.Errorf("Expected a readable dump, got\n%s", dump)
+	}
+
+	if tr.Add("\xff") != nil || tr.Has("\xff") || tr.Delete("\xff") {
+		t.Error("Expected invalid UTF-8 to be rejected")
+	}
+
+	if !tr.Delete("日本") || tr.Has("日本") || !tr.Has("日本語") {
+		t.Error("Unexpected result deleting 日本")
+	}
+	if !tr.Delete("test") || !tr.Has("test") || tr.Delete("nope") || tr.Delete("") {
+		t.Error("Unexpected Delete result")
+	}
+	for _, w := range tr.MembersList() {
+		for tr.Has(w) {
+			tr.Delete(w)
+		}
+	}
+	if len(tr.Members()) != 0 || tr.Dump() != NewRuneTrie().Dump() {
+		t.Errorf("Expected an empty RuneTrie, got\n%s", tr.Dump())
+	}
+}
+
+func TestRuneTrieRandom(t *testing.T) {
+	runes := []rune("aé日本語学校")
+	tr := NewRuneTrie()
+	ref := NewTrie()
+	for n := 0; n < 3000; n++ {
+		str := []rune{}
+		for i := 0; i < 1+rand.Intn(5); i++ {
+			str = append(str, runes[rand.Intn(len(runes))])
+		}
+		if rand.Intn(3) == 0 {
+			if tr.Delete(string(str)) != ref.Delete(string(str)) {
+				t.Fatalf("Delete('%s') differs from Trie.Delete", string(str))
+			}
+		} else {
+			tr.Add(string(str))
+			ref.Add(string(str))
+		}
+	}
+
+	expected := ref.Members()
+	members := tr.Members()
+	if len(members) != len(expected) {
+		t.Fatalf("Expected %v members, got %v instead.", len(expected), len(members))
+	}
+	for i, mi := range expected {
+		if members[i].Value != mi.Value || members[i].Count != mi.Count {
+			t.Errorf("Expected member %v to be %v, got %v instead.", i, mi, members[i])
+		}
+	}
+	for _, prefix := range []string{"", "a", "日", "日本", "é", "語学", "校a"} {
+		e1, c1 := ref.HasPrefixCount(prefix)
+		if e2, c2 := tr.HasPrefixCount(prefix); e1 != e2 || c1 != c2 {
+			t.Errorf("HasPrefixCount('%s'): expected %v %v, got %v %v instead.", prefix, e1, c1, e2, c2)
+		}
+	}
+
+	// the structure does not depend on the order the entries were added in
+	rebuilt := NewRuneTrie()
+	for i := len(members) - 1; i >= 0; i-- {
+		for c := int64(0); c < members[i].Count; c++ {
+			rebuilt.Add(members[i].Value)
+		}
+	}
+	if rebuilt.Dump() != tr.Dump() {
+		t.Errorf("Expected the rebuilt RuneTrie to equal the original, got\n%s\ninstead of\n%s", rebuilt.Dump(), tr.Dump())
+	}
+}
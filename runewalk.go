@@ -0,0 +1,104 @@
+package trie
+
+import (
+	"unicode/utf8"
+)
+
+/*
+walkAction tells a runeWalker what to do with the subtree below a symbol.
+*/
+type walkAction int
+
+const (
+	// visit the subtree
+	walkDescend walkAction = iota
+	// skip the subtree - none of its entries can match
+	walkSkip
+	// take all entries of the subtree - every one of them matches
+	walkTake
+)
+
+/*
+runeWalker walks the Branches of a Trie symbol by symbol and lets `step` decide
+which subtrees to visit. A symbol is a rune or - if `bytes` is set - a single
+byte.
+
+The bytes of a rune can be split across Branches. Trailing bytes of a key that
+do not form a complete rune yet are kept pending and the state stays the same
+until the rune is complete. Invalid UTF-8 is decoded like a range loop over a
+string does: every byte that does not start a valid rune becomes a
+utf8.RuneError - also the incomplete rune at the end of an entry.
+*/
+type runeWalker[S any] struct {
+	bytes bool
+	// step advances the state `st` by the symbol `r`
+	step func(st S, r rune) (next S, action walkAction)
+	// entry is called for every entry of a visited Branch
+	entry func(st S, key string, count int64)
+	// take is called for every Branch whose entries are taken as a whole,
+	// with the state before the symbol that decided it
+	take func(st S, b *Branch, branchPrefix []byte)
+}
+
+/*
+walk visits the Branch `b` in state `st`. `key` holds the bytes leading to `b`,
+the last `pending` of which are the start of a rune that is not complete yet.
+*/
+func (w *runeWalker[S]) walk(b *Branch, key []byte, pending int, st S) {
+	branchPrefix := key
+	for _, lb := range b.LeafValue {
+		key = append(key, lb)
+		next, nextPending, action := w.feed(key[len(key)-pending-1:], st, false)
+		if action == walkTake {
+			w.take(next, b, branchPrefix)
+		}
+		if action != walkDescend {
+			return
+		}
+		st, pending = next, nextPending
+	}
+	if b.End {
+		next, _, action := w.feed(key[len(key)-pending:], st, true)
+		switch action {
+		case walkTake:
+			w.take(next, b, branchPrefix)
+			return
+		case walkDescend:
+			w.entry(next, string(key), b.Count)
+		}
+	}
+	for _, idx := range b.sortedIdxs(false) {
+		nextKey := append(key, idx)
+		next, nextPending, action := w.feed(nextKey[len(nextKey)-pending-1:], st, false)
+		switch action {
+		case walkTake:
+			w.take(next, b.Branches[idx], nextKey)
+		case walkDescend:
+			w.walk(b.Branches[idx], nextKey, nextPending, next)
+		}
+	}
+}
+
+/*
+feed steps the state by all symbols in `tail`. Unless `final` is set a rune at
+the end that is not complete yet is left pending. It returns the new state and
+the number of pending bytes - or for walkSkip and walkTake the state before the
+symbol that decided it.
+*/
+func (w *runeWalker[S]) feed(tail []byte, st S, final bool) (S, int, walkAction) {
+	for len(tail) > 0 {
+		r, size := rune(tail[0]), 1
+		if !w.bytes {
+			if !final && !utf8.FullRune(tail) {
+				break
+			}
+			r, size = utf8.DecodeRune(tail)
+		}
+		next, action := w.step(st, r)
+		if action != walkDescend {
+			return st, 0, action
+		}
+		st, tail = next, tail[size:]
+	}
+	return st, len(tail), walkDescend
+}
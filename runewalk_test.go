@@ -0,0 +1,86 @@
+package trie
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestRuneWalkerInvalidUTF8(t *testing.T) {
+	words := []string{"\xe6a", "\xe6\x97", "\xe6\x97ab", "a\xffb", "日\x97", "日本", "ab", "\xff"}
+	tr := NewTrie()
+	for _, w := range words {
+		tr.Add(w)
+	}
+
+	// like a range loop over a string every invalid byte is a rune on its own
+	countRunes := func(s string) (n int) {
+		for range s {
+			n++
+		}
+		return
+	}
+	for _, pattern := range []string{"?", "??", "???", "????"} {
+		var expected []string
+		for _, w := range tr.MembersList() {
+			if countRunes(w) == len(pattern) {
+				expected = append(expected, w)
+			}
+		}
+		members, _ := tr.Match(pattern)
+		if len(members) != len(expected) {
+			t.Errorf("Expected Match('%s') to be %q, got %v instead.", pattern, expected, members)
+			continue
+		}
+		for i, mi := range members {
+			if mi.Value != expected[i] {
+				t.Errorf("Expected Match('%s') to be %q, got %v instead.", pattern, expected, members)
+				break
+			}
+		}
+	}
+
+	for _, expr := range []string{`^.a$`, `^..$`, `^.\x{FFFD}ab`, `\x{FFFD}b$`, `^日.$`, `^\x{FFFD}+$`, `b$`} {
+		re := regexp.MustCompile(expr)
+		var expected []string
+		for _, w := range tr.MembersList() {
+			if re.MatchString(w) {
+				expected = append(expected, w)
+			}
+		}
+		members, err := tr.RegexpMembers(expr)
+		if err != nil {
+			t.Errorf("Unexpected error for RegexpMembers('%s'): %v", expr, err)
+			continue
+		}
+		if len(members) != len(expected) {
+			t.Errorf("Expected RegexpMembers('%s') to be %q, got %v instead.", expr, expected, members)
+			continue
+		}
+		for i, mi := range members {
+			if mi.Value != expected[i] {
+				t.Errorf("Expected RegexpMembers('%s') to be %q, got %v instead.", expr, expected, members)
+				break
+			}
+		}
+	}
+
+	for _, query := range []string{"\xe6a", "日\xff", "\xff\xffab"} {
+		for _, fm := range tr.FuzzyMembersRunes(query, 1) {
+			if d := levenshtein([]rune(fm.Value), []rune(query)); d != fm.Distance {
+				t.Errorf("Expected the distance of %q to %q to be %v, got %v instead.", fm.Value, query, d, fm.Distance)
+			}
+		}
+		for _, w := range words {
+			if levenshtein([]rune(w), []rune(query)) > 1 {
+				continue
+			}
+			found := false
+			for _, fm := range tr.FuzzyMembersRunes(query, 1) {
+				found = found || fm.Value == w
+			}
+			if !found {
+				t.Errorf("Expected FuzzyMembersRunes(%q, 1) to find %q.", query, w)
+			}
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package trie
+
+/*
+Union returns a new Trie with all entries of `a` and `b`. The count of an entry
+that exists in both is the sum of its counts. Entries keep their payload - the
+one in `a` if they exist in both.
+*/
+func Union(a, b *Trie) *Trie {
+	return combine(a, b, &setOp{
+		keepA:   true,
+		keepB:   true,
+		combine: func(ca, cb int64) int64 { return ca + cb },
+	})
+}
+
+/*
+Intersect returns a new Trie with the entries that exist in both `a` and `b`.
+The count of an entry is the lower of its counts, its payload is the one in
+`a`.
+*/
+func Intersect(a, b *Trie) *Trie {
+	return combine(a, b, &setOp{
+		combine: func(ca, cb int64) int64 {
+			if cb < ca {
+				return cb
+			}
+			return ca
+		},
+	})
+}
+
+/*
+Difference returns a new Trie with the entries of `a` that do not exist in `b`
+with their counts and payloads in `a`.
+*/
+func Difference(a, b *Trie) *Trie {
+	return combine(a, b, &setOp{
+		keepA:   true,
+		combine: func(ca, cb int64) int64 { return 0 },
+	})
+}
+
+/*
+combine walks the Branches of `a` and `b` at the same time and builds the
+Branches of a new Trie from the entries `op` keeps. Subtrees that only exist in
+one of the Tries are copied or skipped as a whole.
+*/
+func combine(a, b *Trie, op *setOp) *Trie {
+	defer rlockBoth(a, b)()
+
+	tr := NewTrie()
+	if root := op.walk(setCursor{a.Root, 0}, setCursor{b.Root, 0}); root != nil {
+		tr.Root = root
+	}
+	return tr
+}
+
+/*
+rlockBoth read locks the Tries `a` and `b` - always in the same order, so two
+goroutines locking the same Tries in opposite order can not deadlock with a
+waiting writer. It returns the function that unlocks them again.
+*/
+func rlockBoth(a, b *Trie) (unlock func()) {
+	if a.Root == b.Root {
+		a.Root.RLock()
+		return a.Root.RUnlock
+	}
+	if a.lockOrder() > b.lockOrder() {
+		a, b = b, a
+	}
+	a.Root.RLock()
+	b.Root.RLock()
+	return func() {
+		b.Root.RUnlock()
+		a.Root.RUnlock()
+	}
+}
+
+/*
+setCursor is a position in a Trie - `off` bytes into the LeafValue of `b`.
+*/
+type setCursor struct {
+	b   *Branch
+	off int
+}
+
+/*
+atBranch returns true if the cursor is at the end of the LeafValue, where the
+Branch can mark an End and branches off.
+*/
+func (c setCursor) atBranch() bool {
+	return c.off == len(c.b.LeafValue)
+}
+
+/*
+subtree returns a copy of everything below the position.
+*/
+func (c setCursor) subtree() *Branch {
+	b := c.b.deepCopy()
+	b.LeafValue = b.LeafValue[c.off:]
+	b.updateDigest()
+	return b
+}
+
+/*
+next returns the bytes that can follow the position in ascending order and the
+positions after them.
+*/
+func (c setCursor) next() (idxs []byte, cursors []setCursor) {
+	if !c.atBranch() {
+		return []byte{c.b.LeafValue[c.off]}, []setCursor{{c.b, c.off + 1}}
+	}
+	idxs = c.b.sortedIdxs(false)
+	cursors = make([]setCursor, len(idxs))
+	for i, idx := range idxs {
+		cursors[i] = setCursor{c.b.Branches[idx], 0}
+	}
+	return
+}
+
+/*
+setOp describes a set operation. Entries that only exist in one Trie are kept
+if `keepA` or `keepB` is set, entries in both get the count returned by
+`combine` - zero or less drops them.
+*/
+type setOp struct {
+	keepA, keepB bool
+	combine      func(ca, cb int64) int64
+}
+
+/*
+walk builds the Branch for the positions `a` and `b`. Its LeafValue starts at
+the positions. It returns nil if the Branch would hold no entries.
+*/
+func (op *setOp) walk(a, b setCursor) *Branch {
+	r := &Branch{
+		Branches: make(map[byte]*Branch),
+	}
+	// follow common LeafValues without descending
+	for !a.atBranch() && !b.atBranch() && a.b.LeafValue[a.off] == b.b.LeafValue[b.off] {
+		r.LeafValue = append(r.LeafValue, a.b.LeafValue[a.off])
+		a.off++
+		b.off++
+	}
+
+	endA, endB := a.atBranch() && a.b.End, b.atBranch() && b.b.End
+	switch {
+	case endA && endB:
+		if count := op.combine(a.b.Count, b.b.Count); count > 0 {
+			r.End, r.Count, r.Payload = true, count, a.b.Payload
+		}
+	case endA && op.keepA:
+		r.End, r.Count, r.Payload = true, a.b.Count, a.b.Payload
+	case endB && op.keepB:
+		r.End, r.Count, r.Payload = true, b.b.Count, b.b.Payload
+	}
+
+	idxsA, nextA := a.next()
+	idxsB, nextB := b.next()
+	i, j := 0, 0
+	for i < len(idxsA) || j < len(idxsB) {
+		switch {
+		case j == len(idxsB) || (i < len(idxsA) && idxsA[i] < idxsB[j]):
+			if op.keepA {
+				r.Branches[idxsA[i]] = nextA[i].subtree()
+			}
+			i++
+		case i == len(idxsA) || idxsB[j] < idxsA[i]:
+			if op.keepB {
+				r.Branches[idxsB[j]] = nextB[j].subtree()
+			}
+			j++
+		default:
+			if br := op.walk(nextA[i], nextB[j]); br != nil {
+				r.Branches[idxsA[i]] = br
+			}
+			i++
+			j++
+		}
+	}
+
+	if !r.End && len(r.Branches) == 0 {
+		return nil
+	}
+	r.pullUp()
+	r.updateMaxCount()
+	return r
+}
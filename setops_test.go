@@ -0,0 +1,177 @@
+package trie
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func TestTrieSetOperations(t *testing.T) {
+	a, b := NewTrie(), NewTrie()
+	a.AddWithCount("test", 2)
+	a.AddWithCount("tea", 5)
+	a.Add("testing")
+	a.Add("日本")
+	b.AddWithCount("test", 4)
+	b.Add("tea")
+	b.Add("toast")
+	b.Add("日本語")
+
+	for name, c := range map[string]struct {
+		result   *Trie
+		expected []*MemberInfo
+	}{
+		"Union":      {Union(a, b), []*MemberInfo{{"tea", 6}, {"test", 6}, {"testing", 1}, {"toast", 1}, {"日本", 1}, {"日本語", 1}}},
+		"Intersect":  {Intersect(a, b), []*MemberInfo{{"tea", 1}, {"test", 2}}},
+		"Difference": {Difference(a, b), []*MemberInfo{{"testing", 1}, {"日本", 1}}},
+		"Self":       {Intersect(a, a), a.Members()},
+	} {
+		members := c.result.Members()
+		if len(members) != len(c.expected) {
+			t.Errorf("%s: Expected members %v, got %v instead.", name, c.expected, members)
+			continue
+		}
+		for i, mi := range c.expected {
+			if members[i].Value != mi.Value || members[i].Count != mi.Count {
+				t.Errorf("%s: Expected member %v to be %v, got %v instead.", name, i, mi, members[i])
+			}
+		}
+	}
+
+	if len(Intersect(a, NewTrie()).Members()) != 0 || len(Difference(a, a).Members()) != 0 {
+		t.Error("Expected empty results")
+	}
+	if u := Union(NewTrie(), NewTrie()); len(u.Members()) != 0 || u.HasPrefix("x") {
+		t.Error("Expected an empty union")
+	}
+}
+
+func TestTrieSetOperationsPayload(t *testing.T) {
+	a, b := NewTrie(), NewTrie()
+	a.Put("both", "a")
+	a.Put("only a", "a")
+	a.Add("subtree")
+	b.Put("both", "b")
+	b.Put("only b", "b")
+
+	union := Union(a, b)
+	for key, expected := range map[string]string{"both": "a", "only a": "a", "only b": "b"} {
+		if v, _ := union.Get(key); v != expected {
+			t.Errorf("Expected the payload of %s to be %v, got %v instead.", key, expected, v)
+		}
+	}
+	if v, _ := Intersect(b, a).Get("both"); v != "b" {
+		t.Errorf("Expected the payload of the first Trie, got %v instead.", v)
+	}
+
+	// the result does not share any Branches with its operands
+	union.Add("subtrees")
+	union.Delete("only a")
+	if a.Has("subtrees") || !a.Has("only a") || a.Dump() == union.Dump() {
+		t.Error("Expected changes to the result to leave the operands alone")
+	}
+}
+
+func TestTrieSetOperationsRandom(t *testing.T) {
+	randomTrie := func() (*Trie, map[string]int64) {
+		tr := NewTrie()
+		for n := 0; n < 300; n++ {
+			str := []byte{}
+			for i := 0; i < 1+rand.Intn(6); i++ {
+				str = append(str, byte('a'+rand.Intn(3)))
+			}
+			tr.Add(string(str))
+		}
+		counts := make(map[string]int64)
+		for _, mi := range tr.Members() {
+			counts[mi.Value] = mi.Count
+		}
+		return tr, counts
+	}
+	build := func(counts map[string]int64) *Trie {
+		var keys []string
+		for k := range counts {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var members []*MemberInfo
+		for _, k := range keys {
+			members = append(members, &MemberInfo{k, counts[k]})
+		}
+		return &Trie{Root: buildFromSortedMembers(members)}
+	}
+
+	for round := 0; round < 20; round++ {
+		a, ca := randomTrie()
+		b, cb := randomTrie()
+		union, intersect, difference := make(map[string]int64), make(map[string]int64), make(map[string]int64)
+		for k, c := range ca {
+			union[k] += c
+			if c2, ok := cb[k]; ok {
+				if c2 < c {
+					c = c2
+				}
+				intersect[k] = c
+			} else {
+				difference[k] = c
+			}
+		}
+		for k, c := range cb {
+			union[k] += c
+		}
+
+		if Union(a, b).Dump() != build(union).Dump() {
+			t.Errorf("Union differs from the expected Trie")
+		}
+		if Intersect(a, b).Dump() != build(intersect).Dump() {
+			t.Errorf("Intersect differs from the expected Trie")
+		}
+		if Difference(a, b).Dump() != build(difference).Dump() {
+			t.Errorf("Difference differs from the expected Trie")
+		}
+	}
+}
+
+func TestTrieSetOperationsConcurrent(t *testing.T) {
+	a, b := NewTrie(), NewTrie()
+	words := []string{"foodie", "foods", "foodchain", "food", "日本", "日本語"}
+	wg := sync.WaitGroup{}
+	// the operands are passed in both orders while writers wait for the locks
+	for n := 0; n < 4; n++ {
+		wg.Add(3)
+		go func() {
+			for i := 0; i < 200; i++ {
+				a.Add(words[i%len(words)])
+				b.Add(words[(i+1)%len(words)])
+			}
+			wg.Done()
+		}()
+		go func() {
+			for i := 0; i < 200; i++ {
+				Union(a, b)
+			}
+			wg.Done()
+		}()
+		go func() {
+			for i := 0; i < 200; i++ {
+				Intersect(b, a)
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+	if u := Union(a, b); len(u.Members()) != len(words) {
+		t.Errorf("Expected %v members, got %v instead.", len(words), u.Members())
+	}
+}
+
+func TestTrieLockOrder(t *testing.T) {
+	a, b := NewTrie(), &Trie{Root: NewTrie().Root}
+	if a.lockOrder() == 0 || b.lockOrder() == 0 || a.lockOrder() == b.lockOrder() {
+		t.Errorf("Expected distinct lock orders, got %v and %v instead.", a.lockOrder(), b.lockOrder())
+	}
+	if order := b.lockOrder(); b.lockOrder() != order {
+		t.Error("Expected the lock order of a Trie to stay the same")
+	}
+}
@@ -0,0 +1,211 @@
+package trie
+
+import (
+	"container/heap"
+)
+
+/*
+ShardedTrie partitions its entries by their first byte across a number of
+independently locked Tries, so writers adding entries with different first
+bytes do not block each other.
+
+Queries for a non empty prefix only touch a single shard, queries for all
+entries merge the results of all shards.
+*/
+type ShardedTrie struct {
+	Shards []*Trie
+}
+
+/*
+NewShardedTrie returns the pointer to a new ShardedTrie with `n` shards. Since
+entries are distributed by their first byte more than 256 shards are of no use.
+*/
+func NewShardedTrie(n int) *ShardedTrie {
+	if n < 1 {
+		n = 1
+	}
+	if n > 256 {
+		n = 256
+	}
+	st := &ShardedTrie{
+		Shards: make([]*Trie, n),
+	}
+	for i := range st.Shards {
+		st.Shards[i] = NewTrie()
+	}
+	return st
+}
+
+/*
+shard returns the Trie that holds the entries starting with `key`.
+*/
+func (st *ShardedTrie) shard(key string) *Trie {
+	if len(key) == 0 {
+		return st.Shards[0]
+	}
+	return st.Shards[int(key[0])%len(st.Shards)]
+}
+
+/*
+Add adds an entry to the ShardedTrie - see Trie.Add.
+*/
+func (st *ShardedTrie) Add(entry string) *Branch {
+	return st.shard(entry).Add(entry)
+}
+
+/*
+Delete decrements the count of an existing entry by one - see Trie.Delete.
+*/
+func (st *ShardedTrie) Delete(entry string) bool {
+	return st.shard(entry).Delete(entry)
+}
+
+/*
+Has returns true if the `entry` exists in the `ShardedTrie`
+*/
+func (st *ShardedTrie) Has(entry string) bool {
+	return st.shard(entry).Has(entry)
+}
+
+/*
+HasCount returns true if the `entry` exists in the `ShardedTrie`. The second
+returned value is the count how often the entry has been set.
+*/
+func (st *ShardedTrie) HasCount(entry string) (exists bool, count int64) {
+	return st.shard(entry).HasCount(entry)
+}
+
+/*
+HasPrefix returns true if the the `ShardedTrie` contains entries with the given
+prefix
+*/
+func (st *ShardedTrie) HasPrefix(prefix string) bool {
+	if len(prefix) > 0 {
+		return st.shard(prefix).HasPrefix(prefix)
+	}
+	for _, t := range st.Shards {
+		if t.HasPrefix(prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+HasPrefixCount returns true if the the `ShardedTrie` contains entries with the
+given prefix. The second returned value is the sum of the counts of these
+entries.
+*/
+func (st *ShardedTrie) HasPrefixCount(prefix string) (exists bool, count int64) {
+	if len(prefix) > 0 {
+		return st.shard(prefix).HasPrefixCount(prefix)
+	}
+	for _, t := range st.Shards {
+		e, c := t.HasPrefixCount(prefix)
+		exists = exists || e
+		count += c
+	}
+	return
+}
+
+/*
+Members returns all entries of the ShardedTrie with their counts as MemberInfo
+in lexicographic (byte) order
+*/
+func (st *ShardedTrie) Members() []*MemberInfo {
+	return st.PrefixMembers("")
+}
+
+/*
+MembersList returns a Slice of all entries of the ShardedTrie in lexicographic
+(byte) order
+*/
+func (st *ShardedTrie) MembersList() (members []string) {
+	for _, mi := range st.Members() {
+		members = append(members, mi.Value)
+	}
+	return
+}
+
+/*
+PrefixMembers returns all entries of the ShardedTrie that have the given prefix
+with their counts as MemberInfo in lexicographic (byte) order
+*/
+func (st *ShardedTrie) PrefixMembers(prefix string) []*MemberInfo {
+	if len(prefix) > 0 {
+		return st.shard(prefix).PrefixMembers(prefix)
+	}
+	lists := make([][]*MemberInfo, len(st.Shards))
+	for i, t := range st.Shards {
+		lists[i] = t.PrefixMembers(prefix)
+	}
+	return mergeMembers(lists)
+}
+
+/*
+PrefixMembersList returns a List of all entries of the ShardedTrie that have
+the given prefix in lexicographic (byte) order
+*/
+func (st *ShardedTrie) PrefixMembersList(prefix string) (members []string) {
+	for _, mi := range st.PrefixMembers(prefix) {
+		members = append(members, mi.Value)
+	}
+	return
+}
+
+/*
+mergeMembers merges lists of MemberInfo that are each in lexicographic order
+into a single list in lexicographic order.
+*/
+func mergeMembers(lists [][]*MemberInfo) (members []*MemberInfo) {
+	total := 0
+	h := make(membersHeap, 0, len(lists))
+	for _, l := range lists {
+		total += len(l)
+		if len(l) > 0 {
+			h = append(h, l)
+		}
+	}
+	heap.Init(&h)
+
+	members = make([]*MemberInfo, 0, total)
+	for len(h) > 0 {
+		members = append(members, h[0][0])
+		if h[0] = h[0][1:]; len(h[0]) == 0 {
+			heap.Pop(&h)
+		} else {
+			heap.Fix(&h, 0)
+		}
+	}
+	return
+}
+
+/*
+membersHeap is a min heap of the lists that are merged by mergeMembers ordered
+by their first MemberInfo. Only non empty lists are on the heap.
+*/
+type membersHeap [][]*MemberInfo
+
+func (h membersHeap) Len() int {
+	return len(h)
+}
+
+func (h membersHeap) Less(i, j int) bool {
+	return h[i][0].Value < h[j][0].Value
+}
+
+func (h membersHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+
+func (h *membersHeap) Push(x interface{}) {
+	*h = append(*h, x.([]*MemberInfo))
+}
+
+func (h *membersHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	l := old[n-1]
+	*h = old[:n-1]
+	return l
+}
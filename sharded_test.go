@@ -0,0 +1,126 @@
+package trie
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+func TestShardedTrie(t *testing.T) {
+	st := NewShardedTrie(4)
+	ref := NewTrie()
+	for _, w := range []string{"tea", "test", "test", "testing", "foo", "bar", "日本", "日本語", "学校"} {
+		st.Add(w)
+		ref.Add(w)
+	}
+
+	expected := ref.MembersList()
+	members := st.MembersList()
+	if len(members) != len(expected) {
+		t.Fatalf("Expected members %v, got %v instead.", expected, members)
+	}
+	for i, m := range members {
+		if m != expected[i] {
+			t.Errorf("Expected member %v to be %s, got %s instead.", i, expected[i], m)
+		}
+	}
+
+	if _, c := st.HasCount("test"); c != 2 {
+		t.Errorf("Expected count for test to be 2. got %v instead.", c)
+	}
+	if !st.Has("日本") || st.Has("日") {
+		t.Error("Unexpected Has result")
+	}
+	if !st.HasPrefix("日") || !st.HasPrefix("") || st.HasPrefix("x") {
+		t.Error("Unexpected HasPrefix result")
+	}
+	if _, c := st.HasPrefixCount("te"); c != 4 {
+		t.Errorf("Expected prefix count for te to be 4. got %v instead.", c)
+	}
+	if _, c := st.HasPrefixCount(""); c != 9 {
+		t.Errorf("Expected prefix count for '' to be 9. got %v instead.", c)
+	}
+	if l := st.PrefixMembersList("te"); len(l) != 3 {
+		t.Errorf("Expected PrefixMembersList('te') to have length 3, got %v instead.", l)
+	}
+
+	if !st.Delete("test") || st.Delete("nope") {
+		t.Error("Unexpected Delete result")
+	}
+	if _, c := st.HasCount("test"); c != 1 {
+		t.Errorf("Expected count for test to be 1. got %v instead.", c)
+	}
+
+	if _, c := NewShardedTrie(0).HasPrefixCount(""); c != 0 {
+		t.Errorf("Expected an empty ShardedTrie to have prefix count 0, got %v instead.", c)
+	}
+}
+
+func TestShardedTrieConcurrentAdd(t *testing.T) {
+	st := NewShardedTrie(8)
+	ref := NewTrie()
+	var words []string
+	for n := 0; n < 1000; n++ {
+		str := []byte{}
+		for i := 0; i < 1+rand.Intn(6); i++ {
+			str = append(str, byte('a'+rand.Intn(26)))
+		}
+		words = append(words, string(str))
+		ref.Add(string(str))
+	}
+
+	wg := sync.WaitGroup{}
+	for n := 0; n < 4; n++ {
+		wg.Add(1)
+		go func(n int) {
+			for i := n; i < len(words); i += 4 {
+				st.Add(words[i])
+			}
+			wg.Done()
+		}(n)
+	}
+	wg.Wait()
+
+	expected := ref.Members()
+	members := st.Members()
+	if len(members) != len(expected) {
+		t.Fatalf("Expected %v members, got %v instead.", len(expected), len(members))
+	}
+	for i, mi := range expected {
+		if members[i].Value != mi.Value || members[i].Count != mi.Count {
+			t.Errorf("Expected member %v to be %v, got %v instead.", i, mi, members[i])
+		}
+	}
+}
+
+func TestMergeMembers(t *testing.T) {
+	lists := make([][]*MemberInfo, 8)
+	total := 0
+	for i := range lists {
+		tr := NewTrie()
+		for n, size := 0, rand.Intn(50); n < size; n++ {
+			tr.Add(string([]byte{byte('a' + i), byte('a' + rand.Intn(26))}))
+		}
+		lists[i] = tr.Members()
+		total += len(lists[i])
+	}
+	// shards hold distinct entries, interleave them by their second byte
+	for i := range lists {
+		for _, mi := range lists[i] {
+			mi.Value = mi.Value[1:] + mi.Value[:1]
+		}
+	}
+
+	members := mergeMembers(lists)
+	if len(members) != total {
+		t.Fatalf("Expected %v members, got %v instead.", total, len(members))
+	}
+	for i := 1; i < len(members); i++ {
+		if members[i].Value <= members[i-1].Value {
+			t.Errorf("Expected members in lexicographic order, got %s after %s", members[i].Value, members[i-1].Value)
+		}
+	}
+	if len(mergeMembers(nil)) != 0 || len(mergeMembers(make([][]*MemberInfo, 3))) != 0 {
+		t.Error("Expected no members from empty lists")
+	}
+}
@@ -0,0 +1,101 @@
+package trie
+
+import (
+	"container/heap"
+)
+
+/*
+TopK returns up to `k` entries of the Trie that have the given prefix, ordered
+by their count (highest first). Entries with the same count are returned in
+lexicographic (byte) order.
+
+The search is guided by the MaxCount of the Branches so only the parts of the
+subtree that can contain one of the top `k` entries are visited.
+*/
+func (t *Trie) TopK(prefix string, k int) (members []*MemberInfo) {
+	t.Root.RLock()
+	defer t.Root.RUnlock()
+	if k <= 0 {
+		return
+	}
+	exists, br, matchedPrefix := t.Root.hasPrefixBranch([]byte(prefix))
+	if !exists || br.MaxCount == 0 {
+		return
+	}
+
+	h := &topKHeap{}
+	heap.Push(h, &topKItem{
+		branch: br,
+		key:    append(matchedPrefix, br.LeafValue...),
+		count:  br.MaxCount,
+	})
+	for h.Len() > 0 && len(members) < k {
+		item := heap.Pop(h).(*topKItem)
+		if item.branch == nil {
+			members = append(members, &MemberInfo{string(item.key), item.count})
+			continue
+		}
+		b := item.branch
+		if b.End {
+			heap.Push(h, &topKItem{key: item.key, count: b.Count})
+		}
+		for idx, child := range b.Branches {
+			if child.MaxCount == 0 {
+				continue
+			}
+			key := make([]byte, 0, len(item.key)+1+len(child.LeafValue))
+			key = append(append(append(key, item.key...), idx), child.LeafValue...)
+			heap.Push(h, &topKItem{branch: child, key: key, count: child.MaxCount})
+		}
+	}
+	return
+}
+
+/*
+topKItem is either a complete entry (branch is nil) with its count or a Branch
+that still needs to be expanded with its MaxCount as count. The key of a
+Branch item includes its LeafValue.
+*/
+type topKItem struct {
+	branch *Branch
+	key    []byte
+	count  int64
+}
+
+/*
+topKHeap is a max heap of topKItems. Items with equal counts are ordered by
+their key. Since the key of a Branch is a prefix of the keys of all entries
+below it this keeps entries with equal counts in lexicographic order. The
+entry of a Branch comes before the Branch itself.
+*/
+type topKHeap []*topKItem
+
+func (h topKHeap) Len() int {
+	return len(h)
+}
+
+func (h topKHeap) Less(i, j int) bool {
+	if h[i].count != h[j].count {
+		return h[i].count > h[j].count
+	}
+	if ki, kj := string(h[i].key), string(h[j].key); ki != kj {
+		return ki < kj
+	}
+	return h[i].branch == nil && h[j].branch != nil
+}
+
+func (h topKHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+
+func (h *topKHeap) Push(x interface{}) {
+	*h = append(*h, x.(*topKItem))
+}
+
+func (h *topKHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
@@ -0,0 +1,123 @@
+package trie
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestTrieTopK(t *testing.T) {
+	tr := NewTrie()
+	for word, count := range map[string]int{"tea": 3, "teased": 1, "test": 5, "testing": 2, "tests": 5, "foo": 9} {
+		for i := 0; i < count; i++ {
+			tr.Add(word)
+		}
+	}
+
+	top := tr.TopK("te", 3)
+	expected := []*MemberInfo{{"test", 5}, {"tests", 5}, {"tea", 3}}
+	if len(top) != len(expected) {
+		t.Fatalf("Expected TopK('te', 3) to return %v entries, got %v instead.", len(expected), top)
+	}
+	for i, mi := range expected {
+		if top[i].Value != mi.Value || top[i].Count != mi.Count {
+			t.Errorf("Expected TopK('te', 3) entry %v to be %v, got %v instead.", i, mi, top[i])
+		}
+	}
+
+	if top = tr.TopK("", 1); len(top) != 1 || top[0].Value != "foo" {
+		t.Errorf("Expected TopK('', 1) to return [foo(9)], got %v instead.", top)
+	}
+	if top = tr.TopK("", 100); len(top) != 6 {
+		t.Errorf("Expected TopK('', 100) to return all 6 entries, got %v instead.", top)
+	}
+	if top = tr.TopK("x", 3); len(top) != 0 {
+		t.Errorf("Expected TopK('x', 3) to return no entries, got %v instead.", top)
+	}
+	if top = tr.TopK("te", 0); len(top) != 0 {
+		t.Errorf("Expected TopK('te', 0) to return no entries, got %v instead.", top)
+	}
+
+	// MaxCount has to follow deletions
+	for i := 0; i < 5; i++ {
+		tr.Delete("test")
+		tr.Delete("tests")
+	}
+	if tr.Root.MaxCount != 9 {
+		t.Errorf("Expected Root MaxCount to be 9, got %v instead.", tr.Root.MaxCount)
+	}
+	top = tr.TopK("te", 2)
+	if len(top) != 2 || top[0].Value != "tea" || top[1].Value != "testing" {
+		t.Errorf("Expected TopK('te', 2) to return [tea(3) testing(2)], got %v instead.", top)
+	}
+}
+
+func TestTrieTopKRandom(t *testing.T) {
+	tr := NewTrie()
+	counts := make(map[string]int64)
+	for n := 0; n < 2000; n++ {
+		str := []byte{}
+		for i := 0; i < 1+rand.Intn(4); i++ {
+			str = append(str, byte('a'+rand.Intn(4)))
+		}
+		tr.Add(string(str))
+		counts[string(str)]++
+		if n%3 == 0 {
+			for w := range counts {
+				tr.Delete(w)
+				if counts[w]--; counts[w] == 0 {
+					delete(counts, w)
+				}
+				break
+			}
+		}
+	}
+
+	var expected []*MemberInfo
+	for w, c := range counts {
+		expected = append(expected, &MemberInfo{w, c})
+	}
+	sort.Slice(expected, func(i, j int) bool {
+		if expected[i].Count != expected[j].Count {
+			return expected[i].Count > expected[j].Count
+		}
+		return expected[i].Value < expected[j].Value
+	})
+
+	top := tr.TopK("", 20)
+	if len(top) != 20 {
+		t.Fatalf("Expected TopK('', 20) to return 20 entries, got %v instead.", len(top))
+	}
+	for i, mi := range top {
+		if mi.Value != expected[i].Value || mi.Count != expected[i].Count {
+			t.Errorf("Expected entry %v to be %v, got %v instead.", i, expected[i], mi)
+		}
+	}
+}
+
+func TestTrieTopKLoadFromFile(t *testing.T) {
+	tr := NewTrie()
+	tr.Add("foo")
+	tr.Add("bar")
+	tr.Add("bar")
+	tr.Add("bar")
+	tr.DumpToFile("testfiles/TestTopKLoadFromFile")
+
+	loadedTrie, err := LoadFromFile("testfiles/TestTopKLoadFromFile")
+	if err != nil {
+		t.Fatalf("Failed to load Trie from file: %v", err)
+	}
+	if top := loadedTrie.TopK("", 1); len(top) != 1 || top[0].Value != "bar" || top[0].Count != 3 {
+		t.Errorf("Expected TopK('', 1) to return [bar(3)], got %v instead.", top)
+	}
+
+	tr2 := NewTrie()
+	tr2.Add("foo")
+	tr2.Add("foo")
+	if err = tr2.MergeFromFile("testfiles/TestTopKLoadFromFile"); err != nil {
+		t.Fatalf("Failed to merge Trie from file: %v", err)
+	}
+	if top := tr2.TopK("", 2); len(top) != 2 || top[0].Value != "bar" || top[1].Value != "foo" {
+		t.Errorf("Expected TopK('', 2) to return [bar(3) foo(3)], got %v instead.", top)
+	}
+}
@@ -2,20 +2,34 @@ package trie
 
 import (
 	"bufio"
-	"bytes"
 	"encoding/gob"
 	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
-	"log"
 	"os"
+	"path/filepath"
+	"sync/atomic"
 	"time"
 )
 
 type Trie struct {
+	// orders the locks of Tries that are locked together - see lockOrder.
+	// first, so it is 64-bit aligned for the atomic operations.
+	id   uint64
 	Root *Branch
+	wal  *WAL
+	// path and checksum of the dump the Trie was loaded from or last written
+	// to. a new WAL is started for it and rolled into it.
+	dump string
+	base uint32
+	// bumped on every change, Iterators use it to notice them
+	version uint64
 }
 
+// the last id given to a Trie
+var trieIds uint64
+
 /*
 NewTrie returns the pointer to a new Trie with an initialized root Branch
 */
@@ -24,10 +38,24 @@ func NewTrie() *Trie {
 		Root: &Branch{
 			Branches: make(map[byte]*Branch),
 		},
+		id: atomic.AddUint64(&trieIds, 1),
 	}
 	return t
 }
 
+/*
+lockOrder returns the unique id of the Trie. Tries that are locked together are
+locked in the order of their ids. A Trie that was not created by NewTrie gets
+its id the first time it is asked for.
+*/
+func (t *Trie) lockOrder() uint64 {
+	if id := atomic.LoadUint64(&t.id); id != 0 {
+		return id
+	}
+	atomic.CompareAndSwapUint64(&t.id, 0, atomic.AddUint64(&trieIds, 1))
+	return atomic.LoadUint64(&t.id)
+}
+
 /*
 Add adds an entry to the trie and returns the branch node that the insertion
 was made at - or rather where the end of the entry was marked.
@@ -35,10 +63,88 @@ was made at - or rather where the end of the entry was marked.
 func (t *Trie) Add(entry string) *Branch {
 	t.Root.Lock()
 	b := t.Root.add([]byte(entry))
+	t.logOp(walAdd, entry, 1)
 	t.Root.Unlock()
 	return b
 }
 
+/*
+AddWithCount adds an entry to the trie `n` times and returns the branch node
+the end of the entry was marked at. A `n` of zero or less does not change the
+trie and returns nil.
+*/
+func (t *Trie) AddWithCount(entry string, n int64) *Branch {
+	if n <= 0 {
+		return nil
+	}
+	t.Root.Lock()
+	b := t.Root.addCount([]byte(entry), n)
+	t.logOp(walAdd, entry, n)
+	t.Root.Unlock()
+	return b
+}
+
+/*
+AddBatch adds all `entries` to the trie holding the lock only once.
+*/
+func (t *Trie) AddBatch(entries []string) {
+	t.Root.Lock()
+	for _, entry := range entries {
+		t.Root.add([]byte(entry))
+		t.logOp(walAdd, entry, 1)
+	}
+	t.Root.Unlock()
+}
+
+/*
+Put attaches `value` to `entry`. If the entry does not exist yet it is added
+with a count of one, otherwise its count stays the same and the previous value
+is replaced. The value is dropped once the entry is deleted.
+*/
+func (t *Trie) Put(entry string, value interface{}) {
+	t.Root.Lock()
+	b := t.Root.getBranch([]byte(entry))
+	if b == nil {
+		b = t.Root.add([]byte(entry))
+		t.logOp(walAdd, entry, 1)
+	}
+	b.Payload = value
+	t.Root.Unlock()
+}
+
+/*
+Get returns the value attached to `entry`. `ok` is false if the entry does not
+exist - an existing entry without a value returns nil and true.
+*/
+func (t *Trie) Get(entry string) (value interface{}, ok bool) {
+	t.Root.RLock()
+	defer t.Root.RUnlock()
+	b := t.Root.getBranch([]byte(entry))
+	if b == nil {
+		return nil, false
+	}
+	return b.Payload, true
+}
+
+/*
+Update replaces the value attached to `entry` with the result of `fn`, which
+gets the current value and whether the entry exists. A missing entry is added
+with a count of one. The Trie is locked while `fn` runs, so `fn` must not call
+any methods of the Trie.
+*/
+func (t *Trie) Update(entry string, fn func(value interface{}, exists bool) interface{}) {
+	t.Root.Lock()
+	b := t.Root.getBranch([]byte(entry))
+	if b == nil {
+		b = t.Root.add([]byte(entry))
+		t.logOp(walAdd, entry, 1)
+		b.Payload = fn(nil, false)
+	} else {
+		b.Payload = fn(b.Payload, true)
+	}
+	t.Root.Unlock()
+}
+
 /*
 Delete decrements the count of an existing entry by one. If the count equals
 zero it removes an the entry from the trie. Returns true if the entry existed,
@@ -52,14 +158,114 @@ func (t *Trie) Delete(entry string) bool {
 	}
 	t.Root.Lock()
 	deleted := t.Root.delete([]byte(entry))
+	if deleted {
+		t.logOp(walDelete, entry, 0)
+	}
 	t.Root.Unlock()
 	return deleted
 }
 
 /*
-GetBranch returns the branch end if the `entry` exists in the `Trie`
+Increment changes the count of `entry` by `delta` and returns the new count.
+A missing entry is added if `delta` is positive, an entry whose count drops to
+zero or below is removed.
+*/
+func (t *Trie) Increment(entry string, delta int64) (count int64) {
+	t.Root.Lock()
+	_, count = t.Root.hasCount([]byte(entry))
+	if count += delta; count < 0 {
+		count = 0
+	}
+	t.Root.setCount([]byte(entry), count)
+	t.logOp(walSetCount, entry, count)
+	t.Root.Unlock()
+	return
+}
+
+/*
+SetCount sets the count of `entry` to `n`. The entry is added if it does not
+exist yet and removed if `n` is zero or less.
+*/
+func (t *Trie) SetCount(entry string, n int64) {
+	t.Root.Lock()
+	t.Root.setCount([]byte(entry), n)
+	t.logOp(walSetCount, entry, n)
+	t.Root.Unlock()
+}
+
+/*
+Remove removes `entry` from the trie regardless of its count. Returns true if
+the entry existed.
+*/
+func (t *Trie) Remove(entry string) bool {
+	if len(entry) == 0 {
+		return false
+	}
+	t.Root.Lock()
+	removed := t.Root.remove([]byte(entry))
+	if removed {
+		t.logOp(walSetCount, entry, 0)
+	}
+	t.Root.Unlock()
+	return removed
+}
+
+/*
+DeletePrefix removes all entries with the given prefix from the trie regardless
+of their counts. It returns the number of removed entries and the sum of their
+counts.
+*/
+func (t *Trie) DeletePrefix(prefix string) (removedEntries int, removedCount int64) {
+	t.Root.Lock()
+	removedEntries, removedCount = t.deletePrefix(prefix)
+	if removedEntries > 0 {
+		t.logOp(walDeletePrefix, prefix, 0)
+	}
+	t.Root.Unlock()
+	return
+}
+
+/*
+deletePrefix removes all entries with the given prefix. The caller has to hold
+the write lock.
+*/
+func (t *Trie) deletePrefix(prefix string) (removedEntries int, removedCount int64) {
+	removedEntries, removedCount, drop := t.Root.deletePrefix([]byte(prefix))
+	if drop {
+		// everything matched - the root can not be detached, so empty it
+		t.Root.Branches = make(map[byte]*Branch)
+		t.Root.LeafValue = nil
+		t.Root.End = false
+		t.Root.Count, t.Root.MaxCount, t.Root.digest = 0, 0, 0
+		t.Root.Payload = nil
+	}
+	return
+}
+
+/*
+DeleteBatch deletes all `entries` from the trie (see Delete) holding the lock
+only once. It returns the number of entries that existed.
+*/
+func (t *Trie) DeleteBatch(entries []string) (deleted int) {
+	t.Root.Lock()
+	for _, entry := range entries {
+		if len(entry) > 0 && t.Root.delete([]byte(entry)) {
+			t.logOp(walDelete, entry, 0)
+			deleted++
+		}
+	}
+	t.Root.Unlock()
+	return
+}
+
+/*
+GetBranch returns the branch end if the `entry` exists in the `Trie`. The
+returned Branch is part of the `Trie` - reading from it while other goroutines
+modify the `Trie` is not safe.
 */
 func (t *Trie) GetBranch(entry string) *Branch {
+	t.Root.RLock()
+	defer t.Root.RUnlock()
 	return t.Root.getBranch([]byte(entry))
 }
 
@@ -67,6 +273,8 @@ func (t *Trie) GetBranch(entry string) *Branch {
 Has returns true if the `entry` exists in the `Trie`
 */
 func (t *Trie) Has(entry string) bool {
+	t.Root.RLock()
+	defer t.Root.RUnlock()
 	return t.Root.has([]byte(entry))
 }
 
@@ -75,6 +283,8 @@ HasCount returns true  if the `entry` exists in the `Trie`. The second returned
 value is the count how often the entry has been set.
 */
 func (t *Trie) HasCount(entry string) (exists bool, count int64) {
+	t.Root.RLock()
+	defer t.Root.RUnlock()
 	return t.Root.hasCount([]byte(entry))
 }
 
@@ -82,6 +292,8 @@ func (t *Trie) HasCount(entry string) (exists bool, count int64) {
 HasPrefix returns true if the the `Trie` contains entries with the given prefix
 */
 func (t *Trie) HasPrefix(prefix string) bool {
+	t.Root.RLock()
+	defer t.Root.RUnlock()
 	return t.Root.hasPrefix([]byte(prefix))
 }
 
@@ -90,21 +302,63 @@ HasPrefixCount returns true if the the `Trie` contains entries with the given
 prefix. The second returned value is the count how often the entry has been set.
 */
 func (t *Trie) HasPrefixCount(prefix string) (exists bool, count int64) {
+	t.Root.RLock()
+	defer t.Root.RUnlock()
 	return t.Root.hasPrefixCount([]byte(prefix))
 }
 
 /*
-Members returns all entries of the Trie with their counts as MemberInfo
+LongestPrefixOf returns the longest entry of the `Trie` that is a prefix of `s`
+(or `s` itself) and its count. `ok` is false if there is no such entry.
+*/
+func (t *Trie) LongestPrefixOf(s string) (entry string, count int64, ok bool) {
+	t.Root.RLock()
+	defer t.Root.RUnlock()
+	length, count, ok := t.Root.longestPrefixOf([]byte(s), 0)
+	if ok {
+		entry = s[:length]
+	}
+	return
+}
+
+/*
+PrefixesOf returns all entries of the `Trie` that are a prefix of `s` (including
+`s` itself) with their counts as MemberInfo, ordered from the shortest to the
+longest.
+*/
+func (t *Trie) PrefixesOf(s string) []*MemberInfo {
+	t.Root.RLock()
+	defer t.Root.RUnlock()
+	return t.Root.prefixesOf([]byte{}, []byte(s))
+}
+
+/*
+Members returns all entries of the Trie with their counts as MemberInfo in
+lexicographic (byte) order
 */
 func (t *Trie) Members() []*MemberInfo {
-	return t.Root.members([]byte{})
+	t.Root.RLock()
+	defer t.Root.RUnlock()
+	return t.Root.members([]byte{}, false)
+}
+
+/*
+MembersReverse returns all entries of the Trie with their counts as MemberInfo
+in reverse lexicographic (byte) order
+*/
+func (t *Trie) MembersReverse() []*MemberInfo {
+	t.Root.RLock()
+	defer t.Root.RUnlock()
+	return t.Root.members([]byte{}, true)
 }
 
 /*
-Members returns a Slice of all entries of the Trie
+Members returns a Slice of all entries of the Trie in lexicographic (byte) order
 */
 func (t *Trie) MembersList() (members []string) {
-	for _, mi := range t.Root.members([]byte{}) {
+	t.Root.RLock()
+	defer t.Root.RUnlock()
+	for _, mi := range t.Root.members([]byte{}, false) {
 		members = append(members, mi.Value)
 	}
 	return
@@ -112,18 +366,32 @@ func (t *Trie) MembersList() (members []string) {
 
 /*
 PrefixMembers returns all entries of the Trie that have the given prefix
-with their counts as MemberInfo
+with their counts as MemberInfo in lexicographic (byte) order
 */
 func (t *Trie) PrefixMembers(prefix string) []*MemberInfo {
-	return t.Root.prefixMembers([]byte{}, []byte(prefix))
+	t.Root.RLock()
+	defer t.Root.RUnlock()
+	return t.Root.prefixMembers([]byte{}, []byte(prefix), false)
+}
+
+/*
+PrefixMembersReverse returns all entries of the Trie that have the given prefix
+with their counts as MemberInfo in reverse lexicographic (byte) order
+*/
+func (t *Trie) PrefixMembersReverse(prefix string) []*MemberInfo {
+	t.Root.RLock()
+	defer t.Root.RUnlock()
+	return t.Root.prefixMembers([]byte{}, []byte(prefix), true)
 }
 
 /*
 PrefixMembers returns a List of all entries of the Trie that have the
-given prefix
+given prefix in lexicographic (byte) order
 */
 func (t *Trie) PrefixMembersList(prefix string) (members []string) {
-	for _, mi := range t.Root.prefixMembers([]byte{}, []byte(prefix)) {
+	t.Root.RLock()
+	defer t.Root.RUnlock()
+	for _, mi := range t.Root.prefixMembers([]byte{}, []byte(prefix), false) {
 		members = append(members, mi.Value)
 	}
 	return
@@ -133,121 +401,351 @@ func (t *Trie) PrefixMembersList(prefix string) (members []string) {
 Dump returns a string representation of the `Trie`
 */
 func (t *Trie) Dump() string {
+	t.Root.RLock()
+	defer t.Root.RUnlock()
 	return t.Root.Dump(0)
 }
 
 /*
- */
+PrintDump prints the Dump of the `Trie` to stdout
+*/
 func (t *Trie) PrintDump() {
-	t.Root.PrintDump()
+	fmt.Printf("\n%s\n\n", t.Dump())
 }
 
 /*
-DumpToFile dumps all values into a slice of strings and writes that to a file
-using encoding/gob.
+Encode writes all entries of the Trie with their counts to `w` using
+encoding/gob.
 
 The Trie itself can currently not be encoded directly because gob does not
 directly support structs with a sync.Mutex on them.
 */
-func (t *Trie) DumpToFile(fname string) (err error) {
-	t.Root.Lock()
-	entries := t.Members()
-	t.Root.Unlock()
+func (t *Trie) Encode(w io.Writer) (err error) {
+	return encodeEntries(w, t.Members())
+}
 
-	buf := new(bytes.Buffer)
-	enc := gob.NewEncoder(buf)
+func encodeEntries(w io.Writer, entries []*MemberInfo) (err error) {
+	enc := gob.NewEncoder(w)
 	if err = enc.Encode(entries); err != nil {
-		err = errors.New(fmt.Sprintf("Could encode Trie entries for dump file: %v", err))
+		err = errors.New(fmt.Sprintf("Could not encode Trie entries: %v", err))
+	}
+	return
+}
+
+/*
+DumpToFile writes all entries of the Trie to a file - see Encode.
+
+The dump is written to a temporary file in the same directory, synced to disk
+and then renamed to `fname`, so an existing dump is never left truncated or
+half written.
+
+If the Trie has an open WAL and `fname` is the dump the log belongs to the log
+is rolled into the dump - see Compact. A dump to any other file is an export
+that leaves the log alone.
+*/
+func (t *Trie) DumpToFile(fname string) (err error) {
+	t.Root.RLock()
+	if t.wal != nil && samePath(t.dump, fname) {
+		t.Root.RUnlock()
+		if err = t.Compact(fname); err == ErrNoWAL {
+			// the log was closed in the meantime
+			return t.DumpToFile(fname)
+		}
 		return
 	}
+	entries, version, logged := t.Root.members([]byte{}, false), t.version, t.wal != nil
+	t.Root.RUnlock()
+
+	base, err := writeDump(fname, entries)
+	if err != nil || logged {
+		return
+	}
+	// the dump is the base for the next log - unless the Trie changed while it
+	// was written
+	t.Root.Lock()
+	if t.wal == nil && t.version == version {
+		t.dump, t.base = fname, base
+	}
+	t.Root.Unlock()
+	return
+}
 
-	f, err := os.Create(fname)
+/*
+writeDump atomically writes `entries` to the file `fname` and returns the
+checksum of the dump.
+*/
+func writeDump(fname string, entries []*MemberInfo) (base uint32, err error) {
+	crc := crc32.NewIEEE()
+	err = writeFileAtomic(fname, func(w io.Writer) error {
+		return encodeEntries(io.MultiWriter(w, crc), entries)
+	})
+	return crc.Sum32(), err
+}
+
+/*
+samePath returns true if the paths `a` and `b` name the same file. An empty
+path names no file.
+*/
+func samePath(a, b string) bool {
+	return a != "" && filepath.Clean(a) == filepath.Clean(b)
+}
+
+/*
+writeFileAtomic writes a file by passing a temporary file in the same
+directory to `write`. Once everything has been written it is synced and
+renamed to `fname`.
+*/
+func writeFileAtomic(fname string, write func(w io.Writer) error) (err error) {
+	dir, base := filepath.Split(fname)
+	if dir == "" {
+		dir = "."
+	}
+	f, err := os.CreateTemp(dir, "."+base+".tmp")
 	if err != nil {
 		err = errors.New(fmt.Sprintf("Could not save dump file: %v", err))
 		return
 	}
-	defer f.Close()
+	tmpName := f.Name()
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(tmpName)
+		}
+	}()
 
 	w := bufio.NewWriter(f)
-	_, err = w.Write(buf.Bytes())
-	if err != nil {
+	if err = write(w); err != nil {
+		return
+	}
+	if err = w.Flush(); err != nil {
+		err = errors.New(fmt.Sprintf("Error writing to dump file: %v", err))
+		return
+	}
+	mode := os.FileMode(0644)
+	if fi, statErr := os.Stat(fname); statErr == nil {
+		mode = fi.Mode().Perm()
+	}
+	if err = f.Chmod(mode); err != nil {
 		err = errors.New(fmt.Sprintf("Error writing to dump file: %v", err))
 		return
 	}
-	// log.Printf("wrote %d bytes to dumpfile %s\n", bl, fname)
-	w.Flush()
+	if err = f.Sync(); err != nil {
+		err = errors.New(fmt.Sprintf("Could not sync dump file: %v", err))
+		return
+	}
+	if err = f.Close(); err != nil {
+		err = errors.New(fmt.Sprintf("Could not close dump file: %v", err))
+		return
+	}
+	if err = os.Rename(tmpName, fname); err != nil {
+		err = errors.New(fmt.Sprintf("Could not save dump file: %v", err))
+		return
+	}
+
+	// make the rename itself durable. not every platform can sync a
+	// directory, so this is best effort.
+	if d, dirErr := os.Open(dir); dirErr == nil {
+		d.Sync()
+		d.Close()
+	}
 	return
 }
 
 /*
-MergeFromFile loads a gib encoded wordlist from a file and Add() them to the `Trie`.
+Logger is what LoadOptions needs to log - *log.Logger implements it.
 */
-// TODO: write tests for merge
-func (t *Trie) MergeFromFile(fname string) (err error) {
-	entries, err := loadTrieFile(fname)
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+/*
+LoadOptions control loading and merging of dumps. The zero value is silent.
+
+Logger gets informational messages like the number of loaded entries and how
+long it took. Progress is called with the number of entries added so far and
+the total number of entries in the dump - at the start, every
+`ProgressInterval` entries (default 10000) and once all entries are added.
+
+Strategy decides the count of entries that already exist when merging - see
+Merge. The default is MergeSum.
+*/
+type LoadOptions struct {
+	Logger           Logger
+	Progress         func(done, total int)
+	ProgressInterval int
+	Strategy         MergeStrategy
+}
+
+func (opts *LoadOptions) logf(format string, v ...interface{}) {
+	if opts != nil && opts.Logger != nil {
+		opts.Logger.Printf(format, v...)
+	}
+}
+
+func (opts *LoadOptions) progress(done, total int) {
+	if opts == nil || opts.Progress == nil {
+		return
+	}
+	interval := opts.ProgressInterval
+	if interval <= 0 {
+		interval = 10000
+	}
+	if done == 0 || done == total || done%interval == 0 {
+		opts.Progress(done, total)
+	}
+}
+
+/*
+MergeFrom reads a gob encoded wordlist written by Encode from `r` and Add()s
+the entries with their counts to the `Trie`. Entries with a count of zero or
+less are skipped.
+*/
+func (t *Trie) MergeFrom(r io.Reader) error {
+	return t.MergeFromWithOptions(r, nil)
+}
+
+/*
+MergeFromWithOptions is MergeFrom with LoadOptions.
+*/
+func (t *Trie) MergeFromWithOptions(r io.Reader, opts *LoadOptions) (err error) {
+	entries, err := decodeEntries(r, opts)
 	if err != nil {
 		return
 	}
-	log.Printf("Got %v entries\n", len(entries))
+	opts.logf("Got %v entries\n", len(entries))
 	startTime := time.Now()
-	for _, mi := range entries {
-		b := t.GetBranch(mi.Value)
-		if b != nil {
-			b.Lock()
-			b.Count += mi.Count
-			b.Unlock()
-		} else {
-			b := t.Add(mi.Value)
-			b.Lock()
-			b.Count = mi.Count
-			b.Unlock()
+	opts.progress(0, len(entries))
+	for i, mi := range entries {
+		// a count of zero or less can only come from a damaged dump
+		if mi.Count > 0 {
+			t.Root.Lock()
+			if exists, count := t.Root.hasCount([]byte(mi.Value)); exists && opts != nil && opts.Strategy != nil {
+				count = opts.Strategy(mi.Value, count, mi.Count)
+				t.Root.setCount([]byte(mi.Value), count)
+				t.logOp(walSetCount, mi.Value, count)
+			} else {
+				t.Root.addCount([]byte(mi.Value), mi.Count)
+				t.logOp(walAdd, mi.Value, mi.Count)
+			}
+			t.Root.Unlock()
 		}
+		opts.progress(i+1, len(entries))
 	}
-	log.Printf("merging words to index took: %v\n", time.Since(startTime))
+	opts.logf("merging words to index took: %v\n", time.Since(startTime))
 	return
 }
 
 /*
-LoadFromFile loads a gib encoded wordlist from a file and creates a new Trie
-by Add()ing all of them.
+MergeFromFile loads a gob encoded wordlist from a file and Add()s them to the
+`Trie` - see MergeFrom.
 */
-func LoadFromFile(fname string) (tr *Trie, err error) {
+func (t *Trie) MergeFromFile(fname string) error {
+	return t.MergeFromFileWithOptions(fname, nil)
+}
+
+/*
+MergeFromFileWithOptions is MergeFromFile with LoadOptions.
+*/
+func (t *Trie) MergeFromFileWithOptions(fname string, opts *LoadOptions) (err error) {
+	f, err := openTrieFile(fname, opts)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	return t.MergeFromWithOptions(bufio.NewReader(f), opts)
+}
+
+/*
+Decode reads a gob encoded wordlist written by Encode from `r` and creates a
+new Trie from it. Entries with a count of zero or less are skipped.
+*/
+func Decode(r io.Reader) (*Trie, error) {
+	return DecodeWithOptions(r, nil)
+}
+
+/*
+DecodeWithOptions is Decode with LoadOptions.
+*/
+func DecodeWithOptions(r io.Reader, opts *LoadOptions) (tr *Trie, err error) {
 	tr = NewTrie()
-	entries, err := loadTrieFile(fname)
+	entries, err := decodeEntries(r, opts)
 	if err != nil {
 		return
 	}
-	log.Printf("Got %v entries\n", len(entries))
+	opts.logf("Got %v entries\n", len(entries))
 	startTime := time.Now()
-	for _, mi := range entries {
-		b := tr.Add(mi.Value)
-		b.Count = mi.Count
+	opts.progress(0, len(entries))
+	// dumps are written in lexicographic order and can be built bottom-up.
+	// older dumps are not sorted and need to be added one by one.
+	if root := buildFromSortedMembers(entries); root != nil {
+		tr.Root = root
+		if len(entries) > 0 {
+			opts.progress(len(entries), len(entries))
+		}
+	} else {
+		tr.Root.Lock()
+		for i, mi := range entries {
+			tr.Root.addCount([]byte(mi.Value), mi.Count)
+			opts.progress(i+1, len(entries))
+		}
+		tr.Root.Unlock()
+	}
+	opts.logf("adding words to index took: %v\n", time.Since(startTime))
+
+	return
+}
+
+/*
+LoadFromFile loads a gob encoded wordlist from a file and creates a new Trie
+from it - see Decode. A WAL opened on the Trie afterwards belongs to this dump -
+see OpenWAL.
+*/
+func LoadFromFile(fname string) (*Trie, error) {
+	return LoadFromFileWithOptions(fname, nil)
+}
+
+/*
+LoadFromFileWithOptions is LoadFromFile with LoadOptions.
+*/
+func LoadFromFileWithOptions(fname string, opts *LoadOptions) (tr *Trie, err error) {
+	f, err := openTrieFile(fname, opts)
+	if err != nil {
+		return NewTrie(), err
 	}
-	log.Printf("adding words to index took: %v\n", time.Since(startTime))
+	defer f.Close()
 
+	// the checksum covers the whole file, also what the decoder did not read
+	crc := crc32.NewIEEE()
+	r := io.TeeReader(f, crc)
+	if tr, err = DecodeWithOptions(bufio.NewReader(r), opts); err != nil {
+		return
+	}
+	if _, err = io.Copy(io.Discard, r); err != nil {
+		err = errors.New(fmt.Sprintf("Could not read Trie file: %v", err))
+		return
+	}
+	tr.dump, tr.base = fname, crc.Sum32()
 	return
 }
 
-func loadTrieFile(fname string) (entries []*MemberInfo, err error) {
-	log.Println("Load trie from", fname)
-	f, err := os.Open(fname)
+func openTrieFile(fname string, opts *LoadOptions) (f *os.File, err error) {
+	opts.logf("Load trie from %s\n", fname)
+	f, err = os.Open(fname)
 	if err != nil {
 		err = errors.New(fmt.Sprintf("Could not open Trie file: %v", err))
-	} else {
-		defer f.Close()
-
-		buf := bufio.NewReader(f)
-		dec := gob.NewDecoder(buf)
-		if err = dec.Decode(&entries); err != nil {
-			if err == io.EOF && entries == nil {
-				log.Println("Nothing to decode. Seems the file is empty.")
-				err = nil
-			} else {
-				err = errors.New(fmt.Sprintf("Decoding error: %v", err))
-				return
-			}
-		}
 	}
+	return
+}
 
+func decodeEntries(r io.Reader, opts *LoadOptions) (entries []*MemberInfo, err error) {
+	dec := gob.NewDecoder(r)
+	if err = dec.Decode(&entries); err != nil {
+		if err == io.EOF && entries == nil {
+			opts.logf("Nothing to decode. Seems the input is empty.\n")
+			err = nil
+		} else {
+			err = errors.New(fmt.Sprintf("Decoding error: %v", err))
+		}
+	}
 	return
 }
@@ -1,9 +1,15 @@
 package trie
 
 import (
+	"bytes"
 	"fmt"
+	"log"
 	"math/rand"
+	"os"
+	"path/filepath"
 	"runtime"
+	"sort"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -236,6 +242,51 @@ func TestTrieMembersCount(t *testing.T) {
 	t.Logf("\n%v", tr.Members())
 }
 
+func TestTrieMembersOrder(t *testing.T) {
+	tr := NewTrie()
+	for _, w := range []string{"testing", "b", "tea", "test", "teased", "a", "日本", "te"} {
+		tr.Add(w)
+	}
+
+	expected := []string{"a", "b", "te", "tea", "teased", "test", "testing", "日本"}
+	members := tr.MembersList()
+	if len(members) != len(expected) {
+		t.Fatalf("Expected %v members, got %v instead.", len(expected), len(members))
+	}
+	for i, m := range members {
+		if m != expected[i] {
+			t.Errorf("Expected member %v to be %s, got %s instead.", i, expected[i], m)
+		}
+	}
+
+	reversed := tr.MembersReverse()
+	for i, mi := range reversed {
+		if mi.Value != expected[len(expected)-1-i] {
+			t.Errorf("Expected reverse member %v to be %s, got %s instead.", i, expected[len(expected)-1-i], mi.Value)
+		}
+	}
+
+	expectedPrefix := []string{"te", "tea", "teased", "test", "testing"}
+	prefixMembers := tr.PrefixMembers("te")
+	if len(prefixMembers) != len(expectedPrefix) {
+		t.Fatalf("Expected %v prefix members, got %v instead.", len(expectedPrefix), len(prefixMembers))
+	}
+	for i, mi := range prefixMembers {
+		if mi.Value != expectedPrefix[i] {
+			t.Errorf("Expected prefix member %v to be %s, got %s instead.", i, expectedPrefix[i], mi.Value)
+		}
+	}
+	for i, mi := range tr.PrefixMembersReverse("te") {
+		if mi.Value != expectedPrefix[len(expectedPrefix)-1-i] {
+			t.Errorf("Expected reverse prefix member %v to be %s, got %s instead.", i, expectedPrefix[len(expectedPrefix)-1-i], mi.Value)
+		}
+	}
+
+	if tr.Dump() != tr.Dump() {
+		t.Error("Expected Dump() to be deterministic.")
+	}
+}
+
 // // todo
 // func TestTriePrefixMembersCount(t *testing.T) {
 // 	tr := NewTrie()
@@ -575,6 +626,377 @@ func TestTrieHasManyMultibyte(t *testing.T) {
 	}
 }
 
+func TestTrieLongestPrefixOf(t *testing.T) {
+	tr := NewTrie()
+	tr.Add("te")
+	tr.Add("test")
+	tr.Add("test")
+	tr.Add("testing")
+	tr.Add("tea")
+
+	entry, count, ok := tr.LongestPrefixOf("tests")
+	if !ok || entry != "test" || count != 2 {
+		t.Errorf("Expected LongestPrefixOf('tests') to be test(2), got %s(%v) %v instead.", entry, count, ok)
+	}
+	entry, _, ok = tr.LongestPrefixOf("testing")
+	if !ok || entry != "testing" {
+		t.Errorf("Expected LongestPrefixOf('testing') to be testing, got %s %v instead.", entry, ok)
+	}
+	entry, _, ok = tr.LongestPrefixOf("tes")
+	if !ok || entry != "te" {
+		t.Errorf("Expected LongestPrefixOf('tes') to be te, got %s %v instead.", entry, ok)
+	}
+	entry, _, ok = tr.LongestPrefixOf("teased")
+	if !ok || entry != "tea" {
+		t.Errorf("Expected LongestPrefixOf('teased') to be tea, got %s %v instead.", entry, ok)
+	}
+	if _, _, ok = tr.LongestPrefixOf("t"); ok {
+		t.Error("Expected LongestPrefixOf('t') to find nothing")
+	}
+	if _, _, ok = tr.LongestPrefixOf("foo"); ok {
+		t.Error("Expected LongestPrefixOf('foo') to find nothing")
+	}
+	if _, _, ok = NewTrie().LongestPrefixOf("foo"); ok {
+		t.Error("Expected LongestPrefixOf('foo') on an empty Trie to find nothing")
+	}
+
+	tr.Add("日本")
+	tr.Add("日本語学校")
+	entry, _, ok = tr.LongestPrefixOf("日本語")
+	if !ok || entry != "日本" {
+		t.Errorf("Expected LongestPrefixOf('日本語') to be 日本, got %s %v instead.", entry, ok)
+	}
+}
+
+func TestTriePrefixesOf(t *testing.T) {
+	tr := NewTrie()
+	tr.Add("te")
+	tr.Add("test")
+	tr.Add("test")
+	tr.Add("testing")
+	tr.Add("tea")
+
+	expected := []*MemberInfo{{"te", 1}, {"test", 2}, {"testing", 1}}
+	prefixes := tr.PrefixesOf("testings")
+	if len(prefixes) != len(expected) {
+		t.Fatalf("Expected PrefixesOf('testings') to be %v, got %v instead.", expected, prefixes)
+	}
+	for i, mi := range expected {
+		if prefixes[i].Value != mi.Value || prefixes[i].Count != mi.Count {
+			t.Errorf("Expected PrefixesOf('testings') entry %v to be %v, got %v instead.", i, mi, prefixes[i])
+		}
+	}
+	if prefixes = tr.PrefixesOf("t"); len(prefixes) != 0 {
+		t.Errorf("Expected PrefixesOf('t') to be empty, got %v instead.", prefixes)
+	}
+	if prefixes = tr.PrefixesOf("tx"); len(prefixes) != 0 {
+		t.Errorf("Expected PrefixesOf('tx') to be empty, got %v instead.", prefixes)
+	}
+}
+
+func TestTriePutGet(t *testing.T) {
+	tr := NewTrie()
+	tr.Put("test", 1)
+	if v, ok := tr.Get("test"); !ok || v != 1 {
+		t.Errorf("Expected Get('test') to be 1, got %v %v instead.", v, ok)
+	}
+	_, c := tr.HasCount("test")
+	if c != 1 {
+		t.Errorf("Expected count for test to be 1. got %v instead.", c)
+	}
+
+	// replacing the value keeps the count
+	tr.Add("test")
+	tr.Put("test", "one")
+	if v, _ := tr.Get("test"); v != "one" {
+		t.Errorf("Expected Get('test') to be one, got %v instead.", v)
+	}
+	_, c = tr.HasCount("test")
+	if c != 2 {
+		t.Errorf("Expected count for test to be 2. got %v instead.", c)
+	}
+
+	if v, ok := tr.Get("tes"); ok || v != nil {
+		t.Errorf("Expected Get('tes') to find nothing, got %v %v instead.", v, ok)
+	}
+	tr.Add("tea")
+	if v, ok := tr.Get("tea"); !ok || v != nil {
+		t.Errorf("Expected Get('tea') to be nil, got %v %v instead.", v, ok)
+	}
+
+	// values have to survive restructuring of the branches
+	tr.Put("testing", 3)
+	tr.Put("te", 4)
+	tr.Put("t", 5)
+	for entry, expected := range map[string]interface{}{"test": "one", "testing": 3, "te": 4, "t": 5} {
+		if v, _ := tr.Get(entry); v != expected {
+			t.Errorf("Expected Get('%s') to be %v, got %v instead.", entry, expected, v)
+		}
+	}
+	tr.Delete("tea")
+	tr.Delete("t")
+	tr.Delete("te")
+	for entry, expected := range map[string]interface{}{"test": "one", "testing": 3} {
+		if v, _ := tr.Get(entry); v != expected {
+			t.Errorf("Expected Get('%s') to be %v, got %v instead.", entry, expected, v)
+		}
+	}
+
+	// the value is dropped with the entry
+	tr.Delete("test")
+	if v, _ := tr.Get("test"); v != "one" {
+		t.Errorf("Expected Get('test') to still be one, got %v instead.", v)
+	}
+	tr.Delete("test")
+	if v, ok := tr.Get("test"); ok || v != nil {
+		t.Errorf("Expected Get('test') to find nothing, got %v %v instead.", v, ok)
+	}
+	tr.Add("test")
+	if v, _ := tr.Get("test"); v != nil {
+		t.Errorf("Expected Get('test') to be nil after re-adding, got %v instead.", v)
+	}
+}
+
+func TestTrieUpdate(t *testing.T) {
+	tr := NewTrie()
+	inc := func(value interface{}, exists bool) interface{} {
+		if !exists {
+			return 1
+		}
+		return value.(int) + 1
+	}
+	tr.Update("test", inc)
+	tr.Update("test", inc)
+	tr.Update("testing", inc)
+	if v, _ := tr.Get("test"); v != 2 {
+		t.Errorf("Expected Get('test') to be 2, got %v instead.", v)
+	}
+	if v, _ := tr.Get("testing"); v != 1 {
+		t.Errorf("Expected Get('testing') to be 1, got %v instead.", v)
+	}
+	_, c := tr.HasCount("test")
+	if c != 1 {
+		t.Errorf("Expected count for test to be 1. got %v instead.", c)
+	}
+}
+
+func TestTrieAddWithCount(t *testing.T) {
+	tr := NewTrie()
+	tr.Add("test")
+	if b := tr.AddWithCount("test", 3); b == nil || b.Count != 4 {
+		t.Errorf("Expected AddWithCount('test', 3) to return a branch with count 4, got %v instead.", b)
+	}
+	tr.AddWithCount("testing", 5)
+	_, c := tr.HasCount("testing")
+	if c != 5 {
+		t.Errorf("Expected count for testing to be 5. got %v instead.", c)
+	}
+	if tr.Root.MaxCount != 5 {
+		t.Errorf("Expected Root MaxCount to be 5. got %v instead.", tr.Root.MaxCount)
+	}
+	if tr.AddWithCount("tea", 0) != nil || tr.Has("tea") {
+		t.Error("Expected AddWithCount('tea', 0) not to add tea")
+	}
+}
+
+func TestTrieIncrementSetCountRemove(t *testing.T) {
+	tr := NewTrie()
+	tr.Add("test")
+	tr.Add("testing")
+	tr.Put("testing", "value")
+
+	if c := tr.Increment("test", 4); c != 5 {
+		t.Errorf("Expected Increment('test', 4) to return 5, got %v instead.", c)
+	}
+	if c := tr.Increment("tea", 2); c != 2 || !tr.Has("tea") {
+		t.Errorf("Expected Increment('tea', 2) to add tea with count 2, got %v instead.", c)
+	}
+	if c := tr.Increment("toast", -1); c != 0 || tr.Has("toast") {
+		t.Errorf("Expected Increment('toast', -1) not to add toast, got %v instead.", c)
+	}
+	if c := tr.Increment("tea", -5); c != 0 || tr.Has("tea") {
+		t.Errorf("Expected Increment('tea', -5) to remove tea, got %v instead.", c)
+	}
+
+	tr.SetCount("testing", 7)
+	if _, c := tr.HasCount("testing"); c != 7 {
+		t.Errorf("Expected count for testing to be 7. got %v instead.", c)
+	}
+	if v, _ := tr.Get("testing"); v != "value" {
+		t.Errorf("Expected SetCount to keep the value of testing, got %v instead.", v)
+	}
+	if tr.Root.MaxCount != 7 {
+		t.Errorf("Expected Root MaxCount to be 7. got %v instead.", tr.Root.MaxCount)
+	}
+	tr.SetCount("te", 3)
+	if _, c := tr.HasCount("te"); c != 3 {
+		t.Errorf("Expected count for te to be 3. got %v instead.", c)
+	}
+	tr.SetCount("te", 0)
+	if tr.Has("te") {
+		t.Error("Expected SetCount('te', 0) to remove te")
+	}
+
+	if !tr.Remove("test") {
+		t.Error("Expected true for tr.Remove('test')")
+	}
+	if tr.Has("test") || !tr.Has("testing") {
+		t.Errorf("Expected Remove('test') to only remove test, got %v instead.", tr.Members())
+	}
+	if tr.Remove("test") || tr.Remove("") {
+		t.Error("Expected false for tr.Remove of a missing entry")
+	}
+	if tr.Root.MaxCount != 7 || string(tr.Root.LeafValue) != "testing" {
+		t.Errorf("Expected a compacted Root holding testing, got\n%s", tr.Dump())
+	}
+}
+
+func TestTrieCountOpsRandom(t *testing.T) {
+	tr := NewTrie()
+	counts := make(map[string]int64)
+	for n := 0; n < 3000; n++ {
+		str := []byte{}
+		for i := 0; i < 1+rand.Intn(5); i++ {
+			str = append(str, byte('a'+rand.Intn(3)))
+		}
+		w := string(str)
+		switch rand.Intn(5) {
+		case 0:
+			tr.Add(w)
+			counts[w]++
+		case 1:
+			tr.Delete(w)
+			if counts[w] > 0 {
+				counts[w]--
+			}
+		case 2:
+			c := int64(rand.Intn(4))
+			tr.SetCount(w, c)
+			counts[w] = c
+		case 3:
+			tr.Remove(w)
+			counts[w] = 0
+		case 4:
+			d := int64(rand.Intn(5) - 2)
+			if counts[w] += d; counts[w] < 0 {
+				counts[w] = 0
+			}
+			if c := tr.Increment(w, d); c != counts[w] {
+				t.Fatalf("Expected Increment('%s', %v) to return %v, got %v instead.", w, d, counts[w], c)
+			}
+		}
+	}
+
+	var words []string
+	for w, c := range counts {
+		for ; c > 0; c-- {
+			words = append(words, w)
+		}
+	}
+	sort.Strings(words)
+	ref, _ := NewTrieFromSorted(words)
+	if tr.Dump() != ref.Dump() {
+		t.Errorf("Expected the same structure as a freshly built Trie, got\n%s\ninstead of\n%s", tr.Dump(), ref.Dump())
+	}
+	if tr.Root.MaxCount != ref.Root.MaxCount {
+		t.Errorf("Expected Root MaxCount %v, got %v instead.", ref.Root.MaxCount, tr.Root.MaxCount)
+	}
+}
+
+func TestTrieDeletePrefix(t *testing.T) {
+	tr := NewTrie()
+	for _, w := range []string{"tea", "teased", "test", "test", "testing", "toast", "foo"} {
+		tr.Add(w)
+	}
+
+	entries, count := tr.DeletePrefix("tes")
+	if entries != 2 || count != 3 {
+		t.Errorf("Expected DeletePrefix('tes') to remove 2 entries with count 3, got %v %v instead.", entries, count)
+	}
+	if l := tr.MembersList(); len(l) != 4 || l[0] != "foo" || l[1] != "tea" || l[2] != "teased" || l[3] != "toast" {
+		t.Errorf("Expected members [foo tea teased toast], got %v instead.", l)
+	}
+
+	entries, count = tr.DeletePrefix("x")
+	if entries != 0 || count != 0 {
+		t.Errorf("Expected DeletePrefix('x') to remove nothing, got %v %v instead.", entries, count)
+	}
+	entries, count = tr.DeletePrefix("teasedx")
+	if entries != 0 || count != 0 {
+		t.Errorf("Expected DeletePrefix('teasedx') to remove nothing, got %v %v instead.", entries, count)
+	}
+
+	// the remaining branches have to be compacted
+	tr.DeletePrefix("t")
+	if string(tr.Root.LeafValue) != "foo" || !tr.Root.End || len(tr.Root.Branches) != 0 {
+		t.Errorf("Expected a compacted Root holding foo, got\n%s", tr.Dump())
+	}
+
+	entries, count = tr.DeletePrefix("")
+	if entries != 1 || count != 1 || len(tr.Members()) != 0 {
+		t.Errorf("Expected DeletePrefix('') to remove everything, got %v %v %v instead.", entries, count, tr.Members())
+	}
+	tr.Add("bar")
+	if !tr.Has("bar") {
+		t.Error("Expected bar")
+	}
+}
+
+func TestTrieDeletePrefixRandom(t *testing.T) {
+	for n := 0; n < 20; n++ {
+		var words []string
+		for i := 0; i < 300; i++ {
+			str := []byte{}
+			for j := 0; j < 1+rand.Intn(5); j++ {
+				str = append(str, byte('a'+rand.Intn(3)))
+			}
+			words = append(words, string(str))
+		}
+		prefix := words[0][:rand.Intn(len(words[0])+1)]
+
+		tr := NewTrie()
+		tr.AddBatch(words)
+		var rest []string
+		var removed int64
+		for _, w := range words {
+			if strings.HasPrefix(w, prefix) {
+				removed++
+			} else {
+				rest = append(rest, w)
+			}
+		}
+		sort.Strings(rest)
+		ref, _ := NewTrieFromSorted(rest)
+
+		if _, count := tr.DeletePrefix(prefix); count != removed {
+			t.Errorf("Expected DeletePrefix('%s') to remove count %v, got %v instead.", prefix, removed, count)
+		}
+		if tr.Dump() != ref.Dump() {
+			t.Errorf("Expected the same structure as a freshly built Trie after DeletePrefix('%s')", prefix)
+		}
+	}
+}
+
+func TestTrieAddDeleteBatch(t *testing.T) {
+	tr := NewTrie()
+	tr.AddBatch([]string{"test", "testing", "test", "tea", "日本"})
+	if len(tr.Members()) != 4 {
+		t.Errorf("Expected 4 members, got %v instead.", tr.Members())
+	}
+	_, c := tr.HasCount("test")
+	if c != 2 {
+		t.Errorf("Expected count for test to be 2. got %v instead.", c)
+	}
+
+	deleted := tr.DeleteBatch([]string{"test", "tea", "nope", "", "日本"})
+	if deleted != 3 {
+		t.Errorf("Expected DeleteBatch to delete 3 entries, got %v instead.", deleted)
+	}
+	if l := tr.MembersList(); len(l) != 2 || l[0] != "test" || l[1] != "testing" {
+		t.Errorf("Expected members [test testing], got %v instead.", l)
+	}
+}
+
 func TestTrieDeleteEmpty(t *testing.T) {
 	tr := NewTrie()
 	if tr.Delete("test") {
@@ -733,6 +1155,34 @@ func TestTrieDeleteMany(t *testing.T) {
 	}
 }
 
+func TestTrieDeletePullUp(t *testing.T) {
+	tr := NewTrie()
+	tr.Add("t")
+	tr.Add("te")
+	tr.Add("test")
+	tr.Add("testing")
+	if !tr.Delete("t") {
+		t.Error("Expected true for tr.Delete('t')")
+	}
+	tr.PrintDump()
+	for _, w := range []string{"te", "test", "testing"} {
+		if !tr.Has(w) {
+			t.Errorf("Expected to still find %s", w)
+		}
+	}
+	if !tr.Delete("te") {
+		t.Error("Expected true for tr.Delete('te')")
+	}
+	for _, w := range []string{"test", "testing"} {
+		if !tr.Has(w) {
+			t.Errorf("Expected to still find %s", w)
+		}
+	}
+	if len(tr.Members()) != 2 {
+		t.Errorf("Expected 2 members, got %v instead.", tr.Members())
+	}
+}
+
 func TestTrieDeleteManyRandom_az(t *testing.T) {
 	tr := NewTrie()
 	var prefix = "prefix"
@@ -869,6 +1319,57 @@ func TestTrieMultiAdd(t *testing.T) {
 	t.Log(tr.Members())
 }
 
+func TestTrieConcurrentReadWrite(t *testing.T) {
+	tr := NewTrie()
+	words := []string{"foodie", "foods", "foodchain", "foodcrave", "food", "人", "日本", "日本語学校", "学校", "日本語"}
+	wg := sync.WaitGroup{}
+	for n := 0; n < 4; n++ {
+		wg.Add(2)
+		go func() {
+			for i := 0; i < 200; i++ {
+				w := words[i%len(words)]
+				tr.Add(w)
+				tr.Put(w, i)
+				if i%3 == 0 {
+					tr.Delete(w)
+				}
+			}
+			wg.Done()
+		}()
+		go func() {
+			for i := 0; i < 200; i++ {
+				w := words[i%len(words)]
+				tr.Has(w)
+				tr.HasCount(w)
+				tr.HasPrefix("foo")
+				tr.HasPrefixCount("日本")
+				tr.Get(w)
+				tr.Members()
+				tr.PrefixMembers("food")
+				tr.TopK("", 3)
+				tr.Walk("foo", func(key string, count int64) bool { return true })
+				for it := tr.Iter("日"); it.Next(); {
+				}
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+
+	expected := make(map[string]int64)
+	for i := 0; i < 200; i++ {
+		if i%3 != 0 {
+			expected[words[i%len(words)]] += 4
+		}
+	}
+	for _, w := range words {
+		_, c := tr.HasCount(w)
+		if c != expected[w] {
+			t.Errorf("Expected count for %s to be %v, got %v instead.", w, expected[w], c)
+		}
+	}
+}
+
 func TestTrieDumpToFileLoadFromFile(t *testing.T) {
 	tr := NewTrie()
 	var prefix = "prefix"
@@ -936,6 +1437,40 @@ func TestTrieDumpToFileLoadFromFile(t *testing.T) {
 	}
 }
 
+func TestTrieDumpToFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	fname := filepath.Join(dir, "dump")
+
+	tr := NewTrie()
+	tr.Add("old")
+	if err := tr.DumpToFile(fname); err != nil {
+		t.Fatalf("Failed to dump Trie: %v", err)
+	}
+	tr.Add("new")
+	if err := tr.DumpToFile(fname); err != nil {
+		t.Fatalf("Failed to dump Trie: %v", err)
+	}
+	loadedTrie, err := LoadFromFile(fname)
+	if err != nil || !loadedTrie.Has("old") || !loadedTrie.Has("new") {
+		t.Errorf("Expected the dump to be replaced, got %v, %v instead.", loadedTrie.Members(), err)
+	}
+
+	// the target can not be replaced - the temporary file must not be left behind
+	sub := filepath.Join(dir, "sub")
+	os.MkdirAll(filepath.Join(sub, "notempty"), 0755)
+	if err = tr.DumpToFile(sub); err == nil {
+		t.Error("Expected DumpToFile() to fail when the target is a directory.")
+	}
+	files, _ := os.ReadDir(dir)
+	if len(files) != 2 || files[0].Name() != "dump" || files[1].Name() != "sub" {
+		var names []string
+		for _, fi := range files {
+			names = append(names, fi.Name())
+		}
+		t.Errorf("Expected only the dump file and the directory to be left, got %v instead.", names)
+	}
+}
+
 func TestTrieLoadFromFileEmpty(t *testing.T) {
 	loadedTrie, err := LoadFromFile("testfiles/empty")
 	if err != nil {
@@ -1002,8 +1537,228 @@ func TestTrieDumpToFileMergeFromFile(t *testing.T) {
 	}
 }
 
+func TestTrieEncodeDecodeMergeFrom(t *testing.T) {
+	tr := NewTrie()
+	tr.Add("test")
+	tr.Add("test")
+	tr.Add("tested")
+	tr.Add("日本語")
+
+	var buf bytes.Buffer
+	if err := tr.Encode(&buf); err != nil {
+		t.Fatalf("Failed to encode Trie: %v", err)
+	}
+	data := buf.Bytes()
+
+	decoded, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to decode Trie: %v", err)
+	}
+	if decoded.Dump() != tr.Dump() {
+		t.Errorf("Expected the decoded Trie to equal the original, got\n%s\ninstead of\n%s", decoded.Dump(), tr.Dump())
+	}
+
+	tr2 := NewTrie()
+	tr2.Add("tested")
+	tr2.Add("tea")
+	if err = tr2.MergeFrom(bytes.NewReader(data)); err != nil {
+		t.Fatalf("Failed to merge Trie: %v", err)
+	}
+	for entry, count := range map[string]int64{"test": 2, "tested": 2, "tea": 1, "日本語": 1} {
+		if _, c := tr2.HasCount(entry); c != count {
+			t.Errorf("Expected count for %s to be %v. got %v instead.", entry, count, c)
+		}
+	}
+
+	empty, err := Decode(bytes.NewReader(nil))
+	if err != nil || len(empty.Members()) != 0 {
+		t.Errorf("Expected an empty Trie from empty input, got %v, %v instead.", empty.Members(), err)
+	}
+	if _, err = Decode(strings.NewReader("not a trie dump")); err == nil {
+		t.Error("Expected Decode to fail on invalid input.")
+	}
+	if err = tr2.MergeFrom(strings.NewReader("not a trie dump")); err == nil {
+		t.Error("Expected MergeFrom to fail on invalid input.")
+	}
+}
+
+func TestTrieLoadWithOptions(t *testing.T) {
+	tr := NewTrie()
+	for i := 0; i < 25; i++ {
+		tr.Add(fmt.Sprintf("entry%02d", i))
+	}
+	fname := "testfiles/TestLoadWithOptions"
+	tr.DumpToFile(fname)
+
+	var logged bytes.Buffer
+	var progress [][2]int
+	opts := &LoadOptions{
+		Logger:           log.New(&logged, "", 0),
+		Progress:         func(done, total int) { progress = append(progress, [2]int{done, total}) },
+		ProgressInterval: 10,
+	}
+
+	loaded, err := LoadFromFileWithOptions(fname, opts)
+	if err != nil || len(loaded.Members()) != 25 {
+		t.Fatalf("Failed to load Trie from file: %v", err)
+	}
+	if !strings.Contains(logged.String(), "Got 25 entries") {
+		t.Errorf("Expected the entry count to be logged, got %q instead.", logged.String())
+	}
+	if len(progress) != 2 || progress[0] != [2]int{0, 25} || progress[1] != [2]int{25, 25} {
+		t.Errorf("Expected progress [[0 25] [25 25]], got %v instead.", progress)
+	}
+
+	logged.Reset()
+	progress = nil
+	merged := NewTrie()
+	merged.Add("entry00")
+	if err = merged.MergeFromFileWithOptions(fname, opts); err != nil {
+		t.Fatalf("Failed to merge Trie from file: %v", err)
+	}
+	expected := [][2]int{{0, 25}, {10, 25}, {20, 25}, {25, 25}}
+	if fmt.Sprint(progress) != fmt.Sprint(expected) {
+		t.Errorf("Expected progress %v, got %v instead.", expected, progress)
+	}
+	if !strings.Contains(logged.String(), "merging words to index took") {
+		t.Errorf("Expected the merge time to be logged, got %q instead.", logged.String())
+	}
+	if _, c := merged.HasCount("entry00"); c != 2 {
+		t.Errorf("Expected count for entry00 to be 2. got %v instead.", c)
+	}
+
+	// merging again with a strategy
+	if err = merged.MergeFromFileWithOptions(fname, &LoadOptions{Strategy: MergeMin}); err != nil {
+		t.Fatalf("Failed to merge Trie from file: %v", err)
+	}
+	if _, c := merged.HasCount("entry00"); c != 1 {
+		t.Errorf("Expected count for entry00 to be 1. got %v instead.", c)
+	}
+}
+
 // some simple benchmarks
 
+func TestTrieAddBelowIdxEnd(t *testing.T) {
+	// the 'a' of tea ends at an idx - its branch has neither a LeafValue nor
+	// Branches but marks an End and must keep it
+	tr := NewTrie()
+	tr.Add("tea")
+	tr.Add("ted")
+	tr.Add("teas")
+	tr.Add("teased")
+
+	expected := []string{"tea", "teas", "teased", "ted"}
+	members := tr.MembersList()
+	if strings.Join(members, " ") != strings.Join(expected, " ") {
+		t.Errorf("Expected members %v, got %v instead.", expected, members)
+	}
+	for _, w := range expected {
+		if _, c := tr.HasCount(w); c != 1 {
+			t.Errorf("Expected count for %s to be 1. got %v instead.", w, c)
+		}
+	}
+	built, _ := NewTrieFromSorted(expected)
+	if tr.Dump() != built.Dump() {
+		t.Errorf("Expected\n%s\ngot\n%s\ninstead.", built.Dump(), tr.Dump())
+	}
+}
+
+func TestTrieDeletePullUpNextBranch(t *testing.T) {
+	for _, c := range []struct {
+		entries []string
+		deleted string
+	}{
+		// the next branch has a LeafValue and Branches of its own
+		{[]string{"ab", "abcde", "abcdf"}, "ab"},
+		// the next branch marks an End and must not be merged any further
+		{[]string{"ab", "abcd", "abcdef"}, "ab"},
+		{[]string{"a", "ab", "abc", "abcd"}, "a"},
+	} {
+		tr := NewTrie()
+		for _, w := range c.entries {
+			tr.Add(w)
+		}
+		tr.Delete(c.deleted)
+
+		expected := c.entries[1:]
+		members := tr.MembersList()
+		if strings.Join(members, " ") != strings.Join(expected, " ") {
+			t.Errorf("Expected members %v after deleting %s, got %v instead.", expected, c.deleted, members)
+		}
+		built, _ := NewTrieFromSorted(expected)
+		if tr.Dump() != built.Dump() {
+			t.Errorf("Expected\n%s\ngot\n%s\ninstead.", built.Dump(), tr.Dump())
+		}
+	}
+}
+
+func TestTrieDeleteCompacts(t *testing.T) {
+	for _, c := range []struct {
+		entries []string
+		deleted string
+	}{
+		{[]string{"tea", "ted"}, "ted"},
+		{[]string{"xtea", "xted", "y"}, "xted"},
+		{[]string{"food", "foodchain", "foodcrave"}, "foodcrave"},
+	} {
+		tr := NewTrie()
+		for _, w := range c.entries {
+			tr.Add(w)
+		}
+		tr.Delete(c.deleted)
+
+		// the branch left with a single branch is merged with it
+		var expected []string
+		for _, w := range c.entries {
+			if w != c.deleted {
+				expected = append(expected, w)
+			}
+		}
+		built, _ := NewTrieFromSorted(expected)
+		if tr.Dump() != built.Dump() {
+			t.Errorf("Expected\n%s\ngot\n%s\ninstead.", built.Dump(), tr.Dump())
+		}
+	}
+}
+
+func TestTrieNonPositiveCounts(t *testing.T) {
+	var buf bytes.Buffer
+	encodeEntries(&buf, []*MemberInfo{{"zero", 0}, {"negative", -3}, {"test", 2}})
+	data := buf.Bytes()
+
+	decoded, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to decode Trie: %v", err)
+	}
+	merged := NewTrie()
+	merged.Add("zero")
+	if err = merged.MergeFromWithOptions(bytes.NewReader(data), &LoadOptions{Strategy: MergeOverwrite}); err != nil {
+		t.Fatalf("Failed to merge Trie: %v", err)
+	}
+	for name, tr := range map[string]*Trie{"Decode": decoded, "MergeFrom": merged} {
+		if tr.Has("negative") {
+			t.Errorf("%s: Expected entries with a negative count to be skipped", name)
+		}
+		if _, c := tr.HasCount("test"); c != 2 {
+			t.Errorf("%s: Expected count for test to be 2. got %v instead.", name, c)
+		}
+	}
+	if decoded.Has("zero") || len(decoded.Members()) != 1 {
+		t.Errorf("Expected only test to be decoded, got %v instead.", decoded.Members())
+	}
+	if _, c := merged.HasCount("zero"); c != 1 {
+		t.Errorf("Expected count for zero to stay 1. got %v instead.", c)
+	}
+
+	tr := NewTrie()
+	if tr.Root.addCount([]byte("zero"), 0) != nil || tr.Root.addCount([]byte("negative"), -1) != nil {
+		t.Error("Expected addCount to return nil for a count of zero or less")
+	}
+	if len(tr.Members()) != 0 || tr.Dump() != NewTrie().Dump() {
+		t.Errorf("Expected an empty Trie, got\n%s", tr.Dump())
+	}
+}
+
 func BenchmarkTrieBenchAdd(b *testing.B) {
 	tr := NewTrie()
 	for x := 0; x < b.N; x++ {
@@ -0,0 +1,381 @@
+package trie
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+/*
+A WAL is an append-only log of the changes made to a Trie since its last dump.
+Together with the dump it allows to restore the Trie after a crash - see
+OpenWAL, Recover and Compact.
+
+The log starts with a header
+
+	magic     4 bytes  "TWAL"
+	version   1 byte
+	base      4 bytes  CRC-32 (IEEE, big endian) of the dump the log applies to
+
+followed by one record per change
+
+	length    uvarint  length of the data
+	data      op byte, key length (uvarint), key, count (varint) for add and
+	          set count operations and the checksum of the new dump for the
+	          record Compact writes before the log is rolled into the dump
+	checksum  4 bytes  CRC-32 (IEEE, big endian) of the data
+
+A record that was only partly written when the process crashed is dropped when
+the log is replayed. Payloads are not logged.
+*/
+type WAL struct {
+	path string
+	f    *os.File
+	err  error
+}
+
+const (
+	walMagic   = "TWAL"
+	walVersion = 1
+
+	walAdd          byte = 1
+	walDelete       byte = 2
+	walSetCount     byte = 3
+	walDeletePrefix byte = 4
+	walRolled       byte = 5
+
+	walMaxRecord = 1 << 30
+)
+
+var (
+	ErrWALOpen = errors.New("The Trie already has an open WAL")
+	ErrNoWAL   = errors.New("The Trie has no open WAL")
+	ErrBadWAL  = errors.New("Not a Trie WAL")
+	ErrWALBase = errors.New("The WAL belongs to another dump")
+)
+
+/*
+OpenWAL opens the log at `path` - creating it if it does not exist - replays
+the changes it contains on top of the current content of the Trie and records
+all further changes to it.
+
+A log belongs to the dump the Trie was loaded from with LoadFromFile or last
+written to with DumpToFile or Compact - or to no dump for a new Trie. Opening a
+log that belongs to another dump fails with ErrWALBase, use Recover to load a
+dump and its log together. Changes made while no log is open are only kept by
+a dump.
+*/
+func (t *Trie) OpenWAL(path string) (err error) {
+	t.Root.Lock()
+	defer t.Root.Unlock()
+	if t.wal != nil {
+		return ErrWALOpen
+	}
+	wal, err := openWAL(path, t.Root, t.base)
+	if err != nil {
+		return
+	}
+	t.version++
+	t.wal = wal
+	return
+}
+
+/*
+Recover loads the dump at `dumpPath` (see LoadFromFile), replays the log at
+`walPath` on top of it and returns the Trie with the log opened. A missing dump
+is treated as an empty Trie.
+
+If the log has already been rolled into the dump - Compact was interrupted
+after the new dump was written - it is not replayed but started anew. A log
+that belongs to another dump - the dump path is wrong or the dump is missing -
+is left alone and ErrWALBase is returned.
+*/
+func Recover(dumpPath string, walPath string) (tr *Trie, err error) {
+	switch _, err = os.Stat(dumpPath); {
+	case err == nil:
+		if tr, err = LoadFromFile(dumpPath); err != nil {
+			return
+		}
+	case os.IsNotExist(err):
+		tr, err = NewTrie(), nil
+		tr.dump = dumpPath
+	default:
+		err = errors.New(fmt.Sprintf("Could not open Trie file: %v", err))
+		return
+	}
+
+	tr.Root.Lock()
+	defer tr.Root.Unlock()
+	if tr.wal, err = openWAL(walPath, tr.Root, tr.base); err != nil {
+		return nil, err
+	}
+	return
+}
+
+/*
+Compact writes the current content of the Trie to a new dump at `dumpPath`
+(see DumpToFile) and starts the log over, so it only records the changes made
+after the dump. The log belongs to the new dump afterwards. The Trie is locked
+until both files are written.
+*/
+func (t *Trie) Compact(dumpPath string) (err error) {
+	t.Root.Lock()
+	defer t.Root.Unlock()
+	if t.wal == nil {
+		return ErrNoWAL
+	}
+	return t.compact(dumpPath)
+}
+
+/*
+compact is Compact for a Trie that is write locked and has an open WAL.
+*/
+func (t *Trie) compact(dumpPath string) (err error) {
+	var buf bytes.Buffer
+	if err = encodeEntries(&buf, t.Root.members([]byte{}, false)); err != nil {
+		return
+	}
+	base := crc32.ChecksumIEEE(buf.Bytes())
+
+	// if we crash before the log is replaced its base does not match the new
+	// dump anymore. the record tells openWAL the log is rolled into the dump
+	// and must not be replayed.
+	t.logOp(walRolled, "", int64(base))
+	if err = t.syncWAL(); err != nil {
+		return
+	}
+	err = writeFileAtomic(dumpPath, func(w io.Writer) error {
+		_, err := w.Write(buf.Bytes())
+		return err
+	})
+	if err != nil {
+		return
+	}
+	t.dump, t.base = dumpPath, base
+
+	wal, err := createWAL(t.wal.path, base)
+	if err != nil {
+		return
+	}
+	t.wal.f.Close()
+	t.wal = wal
+	return
+}
+
+/*
+SyncWAL commits the log to stable storage. It returns the first error that
+occurred while writing to the log.
+*/
+func (t *Trie) SyncWAL() (err error) {
+	t.Root.Lock()
+	defer t.Root.Unlock()
+	if t.wal == nil {
+		return ErrNoWAL
+	}
+	return t.syncWAL()
+}
+
+/*
+syncWAL is SyncWAL for a Trie that is write locked and has an open WAL.
+*/
+func (t *Trie) syncWAL() (err error) {
+	if t.wal.err != nil {
+		return t.wal.err
+	}
+	if err = t.wal.f.Sync(); err != nil {
+		err = errors.New(fmt.Sprintf("Could not sync WAL: %v", err))
+	}
+	return
+}
+
+/*
+CloseWAL syncs and closes the log. Changes made afterwards are not recorded
+anymore.
+*/
+func (t *Trie) CloseWAL() (err error) {
+	t.Root.Lock()
+	defer t.Root.Unlock()
+	if t.wal == nil {
+		return ErrNoWAL
+	}
+	wal := t.wal
+	t.wal = nil
+	err = wal.err
+	if syncErr := wal.f.Sync(); err == nil && syncErr != nil {
+		err = errors.New(fmt.Sprintf("Could not sync WAL: %v", syncErr))
+	}
+	if closeErr := wal.f.Close(); err == nil && closeErr != nil {
+		err = errors.New(fmt.Sprintf("Could not close WAL: %v", closeErr))
+	}
+	return
+}
+
+/*
+logOp records a change: it bumps the version of the Trie and writes the change
+to the log if there is one. The caller has to hold the write lock. Write errors
+are kept and returned by SyncWAL and CloseWAL.
+*/
+func (t *Trie) logOp(op byte, key string, n int64) {
+	t.version++
+	if t.wal == nil || t.wal.err != nil {
+		return
+	}
+	if _, err := t.wal.f.Write(walRecord(op, key, n)); err != nil {
+		t.wal.err = errors.New(fmt.Sprintf("Could not write to WAL: %v", err))
+	}
+}
+
+/*
+walRecord returns the record of a change as it is written to the log.
+*/
+func walRecord(op byte, key string, n int64) []byte {
+	data := make([]byte, 0, 1+binary.MaxVarintLen64+len(key)+binary.MaxVarintLen64)
+	data = append(data, op)
+	data = binary.AppendUvarint(data, uint64(len(key)))
+	data = append(data, key...)
+	if op == walAdd || op == walSetCount || op == walRolled {
+		data = binary.AppendVarint(data, n)
+	}
+
+	record := binary.AppendUvarint(make([]byte, 0, len(data)+binary.MaxVarintLen64+4), uint64(len(data)))
+	record = append(record, data...)
+	return binary.BigEndian.AppendUint32(record, crc32.ChecksumIEEE(data))
+}
+
+/*
+createWAL atomically replaces the file at `path` with an empty log for the
+dump with the checksum `base` and opens it for appending.
+*/
+func createWAL(path string, base uint32) (wal *WAL, err error) {
+	err = writeFileAtomic(path, func(w io.Writer) error {
+		_, err := w.Write(walHeader(base))
+		return err
+	})
+	if err != nil {
+		return
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		err = errors.New(fmt.Sprintf("Could not open WAL: %v", err))
+		return
+	}
+	return &WAL{path: path, f: f}, nil
+}
+
+func walHeader(base uint32) []byte {
+	header := append([]byte(walMagic), walVersion)
+	return binary.BigEndian.AppendUint32(header, base)
+}
+
+/*
+openWAL opens the log at `path` for the dump with the checksum `base` and
+replays it onto `root`, which has to be write locked. A missing log is created
+and a log that has been rolled into the dump is started anew. A log for another
+dump is left alone and ErrWALBase is returned.
+*/
+func openWAL(path string, root *Branch, base uint32) (wal *WAL, err error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if os.IsNotExist(err) {
+		wal, err = createWAL(path, base)
+		return
+	}
+	if err != nil {
+		err = errors.New(fmt.Sprintf("Could not open WAL: %v", err))
+		return
+	}
+
+	r := bufio.NewReader(f)
+	header := make([]byte, len(walHeader(0)))
+	if _, err = io.ReadFull(r, header); err != nil || string(header[:len(walMagic)]) != walMagic || header[len(walMagic)] != walVersion {
+		f.Close()
+		return nil, ErrBadWAL
+	}
+	if binary.BigEndian.Uint32(header[len(walMagic)+1:]) != base {
+		// the changes are replayed onto a scratch Trie only to find out if
+		// the log has been rolled into the dump
+		_, rolled, ok := replayWAL(r, NewTrie().Root)
+		f.Close()
+		if !ok || rolled != base {
+			return nil, ErrWALBase
+		}
+		wal, err = createWAL(path, base)
+		return
+	}
+
+	// replay up to the last complete record and drop anything after it
+	size, _, _ := replayWAL(r, root)
+	size += int64(len(header))
+	if err = f.Truncate(size); err == nil {
+		_, err = f.Seek(size, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		err = errors.New(fmt.Sprintf("Could not open WAL: %v", err))
+		return
+	}
+	return &WAL{path: path, f: f}, nil
+}
+
+/*
+replayWAL applies the records read from `r` to `root` until the end of the log
+or the first incomplete or damaged record. It returns the size of the applied
+records and - if the last record marks the log as rolled into a dump - the
+checksum of that dump.
+*/
+func replayWAL(r *bufio.Reader, root *Branch) (size int64, rolled uint32, ok bool) {
+	t := &Trie{Root: root}
+	for {
+		length, err := binary.ReadUvarint(r)
+		if err != nil || length == 0 || length > walMaxRecord {
+			return
+		}
+		record := make([]byte, length+4)
+		if _, err = io.ReadFull(r, record); err != nil {
+			return
+		}
+		data := record[:length]
+		if binary.BigEndian.Uint32(record[length:]) != crc32.ChecksumIEEE(data) {
+			return
+		}
+
+		op := data[0]
+		keyLen, k := binary.Uvarint(data[1:])
+		if k <= 0 || uint64(len(data)-1-k) < keyLen {
+			return
+		}
+		key := string(data[1+k : 1+k+int(keyLen)])
+		var n int64
+		if op == walAdd || op == walSetCount || op == walRolled {
+			if n, k = binary.Varint(data[1+k+int(keyLen):]); k <= 0 {
+				return
+			}
+		}
+
+		ok = op == walRolled
+		switch op {
+		case walAdd:
+			root.addCount([]byte(key), n)
+		case walDelete:
+			root.delete([]byte(key))
+		case walSetCount:
+			root.setCount([]byte(key), n)
+		case walDeletePrefix:
+			t.deletePrefix(key)
+		case walRolled:
+			rolled = uint32(n)
+		default:
+			return
+		}
+		size += int64(uvarintLen(length)) + int64(len(record))
+	}
+}
+
+func uvarintLen(x uint64) int {
+	var buf [binary.MaxVarintLen64]byte
+	return binary.PutUvarint(buf[:], x)
+}
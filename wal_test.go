@@ -0,0 +1,323 @@
+package trie
+
+import (
+	"bytes"
+	"hash/crc32"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWALRecover(t *testing.T) {
+	dir := t.TempDir()
+	dump, log := filepath.Join(dir, "dump"), filepath.Join(dir, "wal")
+
+	tr, err := Recover(dump, log)
+	if err != nil {
+		t.Fatalf("Failed to recover an empty Trie: %v", err)
+	}
+	tr.Add("test")
+	tr.Add("test")
+	tr.Add("tested")
+	tr.AddWithCount("tea", 5)
+	tr.AddBatch([]string{"foo", "foobar", "foodie"})
+	tr.Delete("tested")
+	tr.DeleteBatch([]string{"foo", "nope"})
+	tr.SetCount("tent", 3)
+	tr.Increment("tea", -2)
+	tr.Remove("test")
+	tr.Put("日本", "value")
+	tr.DeletePrefix("foob")
+	if err = tr.SyncWAL(); err != nil {
+		t.Fatalf("Failed to sync the WAL: %v", err)
+	}
+	expected := tr.Dump()
+
+	// simulate a crash - the log is never closed
+	recovered, err := Recover(dump, log)
+	if err != nil {
+		t.Fatalf("Failed to recover Trie: %v", err)
+	}
+	if recovered.Dump() != expected {
+		t.Errorf("Expected the recovered Trie to equal the original, got\n%s\ninstead of\n%s", recovered.Dump(), expected)
+	}
+
+	// compaction rolls the log into the dump
+	if err = recovered.Compact(dump); err != nil {
+		t.Fatalf("Failed to compact: %v", err)
+	}
+	if fi, _ := os.Stat(log); fi.Size() != int64(len(walHeader(0))) {
+		t.Errorf("Expected the compacted log to be empty, got %v bytes instead.", fi.Size())
+	}
+	recovered.Add("after")
+	if err = recovered.CloseWAL(); err != nil {
+		t.Fatalf("Failed to close the WAL: %v", err)
+	}
+	recovered.Add("not logged")
+
+	again, err := Recover(dump, log)
+	if err != nil {
+		t.Fatalf("Failed to recover Trie: %v", err)
+	}
+	if !again.Has("after") || again.Has("not logged") || !again.Has("foodie") || again.Has("foobar") {
+		t.Errorf("Unexpected members of the recovered Trie: %v", again.Members())
+	}
+	if _, c := again.HasCount("tea"); c != 3 {
+		t.Errorf("Expected count for tea to be 3. got %v instead.", c)
+	}
+	again.CloseWAL()
+}
+
+func TestWALLoadedDump(t *testing.T) {
+	dir := t.TempDir()
+	dump, log := filepath.Join(dir, "dump"), filepath.Join(dir, "wal")
+
+	tr := NewTrie()
+	tr.AddWithCount("dumped", 2)
+	if err := tr.DumpToFile(dump); err != nil {
+		t.Fatalf("Failed to dump Trie: %v", err)
+	}
+
+	loaded, err := LoadFromFile(dump)
+	if err != nil {
+		t.Fatalf("Failed to load Trie: %v", err)
+	}
+	if err = loaded.OpenWAL(log); err != nil {
+		t.Fatalf("Failed to open the WAL: %v", err)
+	}
+	loaded.Add("logged")
+	if err = loaded.SyncWAL(); err != nil {
+		t.Fatalf("Failed to sync the WAL: %v", err)
+	}
+
+	// simulate a crash - the log is never closed
+	recovered, err := Recover(dump, log)
+	if err != nil {
+		t.Fatalf("Failed to recover Trie: %v", err)
+	}
+	if !recovered.Has("logged") || !recovered.Has("dumped") {
+		t.Errorf("Expected the logged entry to be recovered, got %v instead.", recovered.Members())
+	}
+
+	// a dump written while the log is open rolls the log into it
+	recovered.Add("before dump")
+	if err = recovered.DumpToFile(dump); err != nil {
+		t.Fatalf("Failed to dump Trie: %v", err)
+	}
+	if fi, _ := os.Stat(log); fi.Size() != int64(len(walHeader(0))) {
+		t.Errorf("Expected the log to be empty after the dump, got %v bytes instead.", fi.Size())
+	}
+	recovered.Add("after dump")
+	recovered.SyncWAL()
+
+	again, err := Recover(dump, log)
+	if err != nil {
+		t.Fatalf("Failed to recover Trie: %v", err)
+	}
+	if !again.Has("logged") || !again.Has("before dump") || !again.Has("after dump") {
+		t.Errorf("Unexpected members of the recovered Trie: %v", again.Members())
+	}
+	again.CloseWAL()
+	recovered.CloseWAL()
+
+	// the log does not belong to an empty Trie and must be left alone
+	if err = NewTrie().OpenWAL(log); err != ErrWALBase {
+		t.Errorf("Expected ErrWALBase, got %v instead.", err)
+	}
+	if fi, _ := os.Stat(log); fi.Size() == int64(len(walHeader(0))) {
+		t.Error("Expected the log to be kept")
+	}
+}
+
+func TestWALExport(t *testing.T) {
+	dir := t.TempDir()
+	dump, log, export := filepath.Join(dir, "dump"), filepath.Join(dir, "wal"), filepath.Join(dir, "export")
+
+	tr, err := Recover(dump, log)
+	if err != nil {
+		t.Fatalf("Failed to recover an empty Trie: %v", err)
+	}
+	tr.Add("one")
+	tr.Compact(dump)
+	tr.Add("two")
+	tr.Add("three")
+	// an export must neither reset the log nor tie it to the exported file
+	if err = tr.DumpToFile(export); err != nil {
+		t.Fatalf("Failed to export Trie: %v", err)
+	}
+	tr.Add("four")
+	if err = tr.SyncWAL(); err != nil {
+		t.Fatalf("Failed to sync the WAL: %v", err)
+	}
+
+	// simulate a crash - the log is never closed
+	recovered, err := Recover(dump, log)
+	if err != nil {
+		t.Fatalf("Failed to recover Trie: %v", err)
+	}
+	expected := []string{"four", "one", "three", "two"}
+	if members := recovered.MembersList(); strings.Join(members, " ") != strings.Join(expected, " ") {
+		t.Errorf("Expected members %v, got %v instead.", expected, members)
+	}
+	recovered.CloseWAL()
+
+	exported, err := LoadFromFile(export)
+	if err != nil || len(exported.Members()) != 3 || exported.Has("four") {
+		t.Errorf("Unexpected exported Trie: %v, %v", exported.Members(), err)
+	}
+}
+
+func TestWALTornRecord(t *testing.T) {
+	dir := t.TempDir()
+	log := filepath.Join(dir, "wal")
+
+	tr := NewTrie()
+	if err := tr.OpenWAL(log); err != nil {
+		t.Fatalf("Failed to open the WAL: %v", err)
+	}
+	if tr.OpenWAL(log) != ErrWALOpen {
+		t.Error("Expected a second OpenWAL to fail")
+	}
+	tr.Add("complete")
+	tr.Add("torn")
+	tr.CloseWAL()
+
+	// cut the last record in half
+	fi, _ := os.Stat(log)
+	os.Truncate(log, fi.Size()-3)
+
+	tr2 := NewTrie()
+	if err := tr2.OpenWAL(log); err != nil {
+		t.Fatalf("Failed to open the WAL: %v", err)
+	}
+	if !tr2.Has("complete") || tr2.Has("torn") {
+		t.Errorf("Expected only the complete record to be replayed, got %v instead.", tr2.Members())
+	}
+	// new records go after the last complete one
+	tr2.Add("next")
+
+	// a damaged record with a non positive count must not add anything
+	tr2.Root.Lock()
+	tr2.logOp(walAdd, "negative", -1)
+	tr2.logOp(walAdd, "zero", 0)
+	tr2.Root.Unlock()
+	tr2.CloseWAL()
+
+	tr3 := NewTrie()
+	tr3.OpenWAL(log)
+	if !tr3.Has("complete") || !tr3.Has("next") || len(tr3.Members()) != 2 {
+		t.Errorf("Unexpected members after replay: %v", tr3.Members())
+	}
+	tr3.CloseWAL()
+
+	os.WriteFile(log, []byte("not a wal"), 0644)
+	if NewTrie().OpenWAL(log) != ErrBadWAL {
+		t.Error("Expected OpenWAL to fail on a file that is not a WAL")
+	}
+	if NewTrie().SyncWAL() != ErrNoWAL || NewTrie().CloseWAL() != ErrNoWAL || NewTrie().Compact(log) != ErrNoWAL {
+		t.Error("Expected ErrNoWAL for a Trie without a WAL")
+	}
+}
+
+func TestWALInterruptedCompaction(t *testing.T) {
+	dir := t.TempDir()
+	dump, log := filepath.Join(dir, "dump"), filepath.Join(dir, "wal")
+
+	tr, _ := Recover(dump, log)
+	tr.AddWithCount("foo", 2)
+	tr.CloseWAL()
+	stale, _ := os.ReadFile(log)
+
+	tr, _ = Recover(dump, log)
+	tr.Compact(dump)
+	tr.CloseWAL()
+	data, _ := os.ReadFile(dump)
+
+	// the crash happened after the dump was written but before the log was
+	// replaced. Compact has marked the old log as rolled into the new dump.
+	os.WriteFile(log, append(stale, walRecord(walRolled, "", int64(crc32.ChecksumIEEE(data)))...), 0644)
+	tr, err := Recover(dump, log)
+	if err != nil {
+		t.Fatalf("Failed to recover Trie: %v", err)
+	}
+	if _, c := tr.HasCount("foo"); c != 2 {
+		t.Errorf("Expected count for foo to be 2. got %v instead.", c)
+	}
+	tr.CloseWAL()
+
+	// changes logged after the mark did not make it into the dump
+	os.WriteFile(log, append(append(stale, walRecord(walRolled, "", int64(crc32.ChecksumIEEE(data)))...), walRecord(walAdd, "bar", 1)...), 0644)
+	if _, err = Recover(dump, log); err != ErrWALBase {
+		t.Errorf("Expected ErrWALBase for a log with changes after the mark, got %v instead.", err)
+	}
+}
+
+func TestWALWrongDump(t *testing.T) {
+	dir := t.TempDir()
+	dump, log := filepath.Join(dir, "dump"), filepath.Join(dir, "wal")
+
+	tr, _ := Recover(dump, log)
+	tr.Add("dumped")
+	tr.Compact(dump)
+	tr.Add("logged")
+	tr.CloseWAL()
+	logged, _ := os.ReadFile(log)
+
+	other := NewTrie()
+	other.Add("other")
+	other.DumpToFile(filepath.Join(dir, "other"))
+	for _, path := range []string{filepath.Join(dir, "other"), filepath.Join(dir, "missing")} {
+		if _, err := Recover(path, log); err != ErrWALBase {
+			t.Errorf("Expected ErrWALBase recovering with %s, got %v instead.", path, err)
+		}
+		if data, _ := os.ReadFile(log); !bytes.Equal(data, logged) {
+			t.Errorf("Expected the log to be left alone recovering with %s", path)
+		}
+	}
+
+	tr, err := Recover(dump, log)
+	if err != nil {
+		t.Fatalf("Failed to recover Trie: %v", err)
+	}
+	if !tr.Has("logged") || !tr.Has("dumped") {
+		t.Errorf("Unexpected members of the recovered Trie: %v", tr.Members())
+	}
+	tr.CloseWAL()
+}
+
+func TestWALRandom(t *testing.T) {
+	dir := t.TempDir()
+	dump, log := filepath.Join(dir, "dump"), filepath.Join(dir, "wal")
+
+	tr, _ := Recover(dump, log)
+	for n := 0; n < 2000; n++ {
+		str := []byte{}
+		for i := 0; i < 1+rand.Intn(5); i++ {
+			str = append(str, byte('a'+rand.Intn(3)))
+		}
+		switch rand.Intn(5) {
+		case 0:
+			tr.Delete(string(str))
+		case 1:
+			tr.Increment(string(str), int64(rand.Intn(5)-2))
+		default:
+			tr.Add(string(str))
+		}
+		if n%700 == 0 {
+			tr.Compact(dump)
+		}
+	}
+	expected := tr.Dump()
+	tr.CloseWAL()
+
+	recovered, err := Recover(dump, log)
+	if err != nil {
+		t.Fatalf("Failed to recover Trie: %v", err)
+	}
+	if recovered.Dump() != expected {
+		t.Error("Expected the recovered Trie to equal the original")
+	}
+	recovered.CloseWAL()
+}